@@ -44,6 +44,9 @@ type IndexedCheckpointer struct {
 	bs                    machine.BlockStore
 	nextCheckpointToWrite *writableCheckpoint
 	maxReorgHeight        *big.Int
+
+	// archiveInterval is nil unless old checkpoints are being kept
+	archiveInterval *big.Int
 }
 
 func NewIndexedCheckpointer(
@@ -64,7 +67,38 @@ func NewIndexedCheckpointer(
 	}
 
 	go ret.writeDaemon()
-	go cleanupDaemon(ret.bs, ret.db, maxReorgHeight)
+	go cleanupDaemon(ret.bs, ret.db, maxReorgHeight, nil)
+	return ret, nil
+}
+
+// NewArchiveIndexedCheckpointer creates a checkpointer which, rather than
+// deleting every checkpoint more than maxReorgHeight blocks old, keeps the
+// latest checkpoint in each span of archiveInterval blocks so that historical
+// state can be restored with RestoreStateAt
+func NewArchiveIndexedCheckpointer(
+	rollupAddr common.Address,
+	databasePath string,
+	maxReorgHeight *big.Int,
+	archiveInterval *big.Int,
+	forceFreshStart bool,
+) (*IndexedCheckpointer, error) {
+	if archiveInterval.Sign() <= 0 {
+		return nil, errors.New("archive interval must be positive")
+	}
+	ret, err := newIndexedCheckpointer(
+		rollupAddr,
+		databasePath,
+		new(big.Int).Set(maxReorgHeight),
+		forceFreshStart,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	ret.archiveInterval = new(big.Int).Set(archiveInterval)
+
+	go ret.writeDaemon()
+	go cleanupDaemon(ret.bs, ret.db, maxReorgHeight, ret.archiveInterval)
 	return ret, nil
 }
 
@@ -97,6 +131,7 @@ func newIndexedCheckpointer(
 		cCheckpointer.GetBlockStore(),
 		nil,
 		maxReorgHeight,
+		nil,
 	}, nil
 }
 
@@ -181,31 +216,88 @@ func restoreLatestState(
 		if err != nil {
 			return err
 		}
-		blockData, err := bs.GetBlock(onchainId)
-		if err != nil {
-			// If no record was found, try the next block
-			continue
+		if restoreCheckpoint(bs, db, onchainId, unmarshalFunc) {
+			return nil
 		}
-		ckpWithMan := &CheckpointWithManifest{}
-		if err := proto.Unmarshal(blockData, ckpWithMan); err != nil {
-			// If something went wrong, try the next block
+	}
+	return errNoMatchingCheckpoint
+}
+
+// RestoreStateAt restores the latest checkpoint at or before the given height
+// which is still part of the L1 chain. Unlike RestoreLatestState, heights
+// without a saved checkpoint are skipped without querying the L1
+func (cp *IndexedCheckpointer) RestoreStateAt(
+	ctx context.Context,
+	clnt arbbridge.ChainTimeGetter,
+	height *common.TimeBlocks,
+	unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+) error {
+	return restoreStateAt(ctx, cp.bs, cp.db, clnt, height, unmarshalFunc)
+}
+
+func restoreStateAt(
+	ctx context.Context,
+	bs machine.BlockStore,
+	db machine.CheckpointStorage,
+	clnt arbbridge.ChainTimeGetter,
+	startHeight *common.TimeBlocks,
+	unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+) error {
+	if bs.IsBlockStoreEmpty() {
+		return errNoCheckpoint
+	}
+
+	if maxHeight := bs.MaxBlockStoreHeight(); startHeight.Cmp(maxHeight) > 0 {
+		startHeight = maxHeight
+	}
+	lowestHeight := bs.MinBlockStoreHeight()
+
+	for height := startHeight; height.Cmp(lowestHeight) >= 0; height = common.NewTimeBlocks(new(big.Int).Sub(height.AsInt(), big.NewInt(1))) {
+		if len(bs.BlocksAtHeight(height)) == 0 {
 			continue
 		}
-
-		rcl, err := newRestoreContextLocked(db, ckpWithMan.Manifest)
+		onchainId, err := clnt.BlockIdForHeight(ctx, height)
 		if err != nil {
-			log.Println("Failed load manifest data at height", height, "with error", err)
-			continue
+			return err
 		}
-		if err := unmarshalFunc(ckpWithMan.Contents, rcl, onchainId); err != nil {
-			log.Println("Failed load checkpoint at height", height, "with error", err)
-			continue
+		if restoreCheckpoint(bs, db, onchainId, unmarshalFunc) {
+			return nil
 		}
-		return nil
 	}
 	return errNoMatchingCheckpoint
 }
 
+// restoreCheckpoint returns false if the checkpoint for the block couldn't be
+// loaded
+func restoreCheckpoint(
+	bs machine.BlockStore,
+	db machine.CheckpointStorage,
+	onchainId *common.BlockId,
+	unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+) bool {
+	blockData, err := bs.GetBlock(onchainId)
+	if err != nil {
+		// If no record was found, try the next block
+		return false
+	}
+	ckpWithMan := &CheckpointWithManifest{}
+	if err := proto.Unmarshal(blockData, ckpWithMan); err != nil {
+		// If something went wrong, try the next block
+		return false
+	}
+
+	rcl, err := newRestoreContextLocked(db, ckpWithMan.Manifest)
+	if err != nil {
+		log.Println("Failed load manifest data at height", onchainId.Height, "with error", err)
+		return false
+	}
+	if err := unmarshalFunc(ckpWithMan.Contents, rcl, onchainId); err != nil {
+		log.Println("Failed load checkpoint at height", onchainId.Height, "with error", err)
+		return false
+	}
+	return true
+}
+
 func (cp *IndexedCheckpointer) writeDaemon() {
 	ticker := time.NewTicker(common.NewTimeBlocksInt(2).Duration())
 	defer ticker.Stop()
@@ -248,35 +340,74 @@ func writeCheckpoint(bs machine.BlockStore, db machine.CheckpointStorage, wc *wr
 	return nil
 }
 
-func cleanupDaemon(bs machine.BlockStore, db machine.CheckpointStorage, maxReorgHeight *big.Int) {
+func cleanupDaemon(bs machine.BlockStore, db machine.CheckpointStorage, maxReorgHeight *big.Int, archiveInterval *big.Int) {
 	ticker := time.NewTicker(common.NewTimeBlocksInt(25).Duration())
 	defer ticker.Stop()
+	// Archived checkpoints are never deleted, so each pass resumes from
+	// where the last one finished instead of from the oldest checkpoint
+	var start *common.TimeBlocks
 	for {
 		<-ticker.C
-		cleanup(bs, db, maxReorgHeight)
+		if archiveInterval == nil {
+			cleanup(bs, db, maxReorgHeight)
+		} else {
+			start = cleanupFrom(bs, db, maxReorgHeight, archiveInterval, start)
+		}
 	}
 }
 
 func cleanup(bs machine.BlockStore, db machine.CheckpointStorage, maxReorgHeight *big.Int) {
-	currentMin := bs.MinBlockStoreHeight()
+	cleanupFrom(bs, db, maxReorgHeight, nil, nil)
+}
+
+// cleanupFrom deletes checkpoints older than maxReorgHeight blocks which have
+// been superseded, starting at the given height or at the oldest checkpoint if
+// start is nil. If archiveInterval is set, the latest checkpoint in each span
+// of archiveInterval blocks is kept. It returns the height of the latest
+// checkpoint it examined, from which the next pass can start
+func cleanupFrom(bs machine.BlockStore, db machine.CheckpointStorage, maxReorgHeight *big.Int, archiveInterval *big.Int, start *common.TimeBlocks) *common.TimeBlocks {
+	if start == nil {
+		currentMin := bs.MinBlockStoreHeight()
+		start = common.NewTimeBlocks(new(big.Int).Sub(currentMin.AsInt(), big.NewInt(1)))
+	}
 	currentMax := bs.MaxBlockStoreHeight()
-	height := common.NewTimeBlocks(new(big.Int).Sub(currentMin.AsInt(), big.NewInt(1)))
+	height := start
 	heightLimit := common.NewTimeBlocks(new(big.Int).Sub(currentMax.AsInt(), maxReorgHeight))
 	var prevIds []*common.BlockId
+	var prevHeight *common.TimeBlocks
 	for height.Cmp(heightLimit) < 0 {
 		blockIds := bs.BlocksAtHeight(height)
 		if len(blockIds) > 0 {
-			for _, id := range prevIds {
-				err := deleteCheckpointForKey(bs, db, id)
-				if err != nil {
-					// Can still continue if error
-					log.Printf("Nonfatal error deleting checkpoint for key %s: %s", id.String(), err.Error())
+			if !archived(archiveInterval, prevHeight, height) {
+				for _, id := range prevIds {
+					err := deleteCheckpointForKey(bs, db, id)
+					if err != nil {
+						// Can still continue if error
+						log.Printf("Nonfatal error deleting checkpoint for key %s: %s", id.String(), err.Error())
+					}
 				}
 			}
 			prevIds = blockIds
+			prevHeight = height
 		}
 		height = common.NewTimeBlocks(new(big.Int).Add(height.AsInt(), big.NewInt(1)))
 	}
+	if prevHeight == nil {
+		return start
+	}
+	return prevHeight
+}
+
+// archived returns true if the checkpoint at prevHeight is the latest one in
+// its span of archiveInterval blocks, given that the next checkpoint is at
+// height
+func archived(archiveInterval *big.Int, prevHeight *common.TimeBlocks, height *common.TimeBlocks) bool {
+	if archiveInterval == nil || prevHeight == nil {
+		return false
+	}
+	prevSpan := new(big.Int).Div(prevHeight.AsInt(), archiveInterval)
+	span := new(big.Int).Div(height.AsInt(), archiveInterval)
+	return prevSpan.Cmp(span) != 0
 }
 
 func deleteCheckpointForKey(bs machine.BlockStore, db machine.CheckpointStorage, id *common.BlockId) error {
@@ -355,3 +355,100 @@ func TestCleanup(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestArchiveCleanup(t *testing.T) {
+	var rollupAddr common.Address
+	cp, err := newIndexedCheckpointer(rollupAddr, dbPath, maxReorgHeight, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.db.CloseCheckpointStorage()
+
+	checkpointContext := ckptcontext.NewCheckpointContext()
+	for _, blockId := range []*common.BlockId{initialEntryBlockId, laterEntryBlockId, distantEntryBlockId} {
+		if err = writeCheckpoint(cp.bs, cp.db, &writableCheckpoint{
+			blockId:  blockId,
+			contents: checkpointData,
+			ckpCtx:   checkpointContext,
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Heights 10 and 15 fall in different spans so both are kept
+	next := cleanupFrom(cp.bs, cp.db, big.NewInt(100), big.NewInt(12), nil)
+	if next.Cmp(laterEntryBlockId.Height) != 0 {
+		t.Error("cleanup should resume from the latest checkpoint examined", next)
+	}
+	for _, blockId := range []*common.BlockId{initialEntryBlockId, laterEntryBlockId, distantEntryBlockId} {
+		if _, err := cp.bs.GetBlock(blockId); err != nil {
+			t.Error("checkpoint at", blockId.Height, "was deleted:", err)
+		}
+	}
+
+	// Heights 10 and 15 fall in the same span so only the later is kept
+	cleanupFrom(cp.bs, cp.db, big.NewInt(100), big.NewInt(20), nil)
+	if cp.bs.MinBlockStoreHeight().Cmp(laterEntryBlockId.Height) != 0 {
+		t.Error("minimum height incorrect after cleanup", cp.bs.MinBlockStoreHeight())
+	}
+}
+
+func TestRestoreStateAt(t *testing.T) {
+	var rollupAddr common.Address
+	cp, err := newIndexedCheckpointer(rollupAddr, dbPath, maxReorgHeight, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.db.CloseCheckpointStorage()
+
+	checkpointContext := ckptcontext.NewCheckpointContext()
+	if err = writeCheckpoint(cp.bs, cp.db, &writableCheckpoint{
+		blockId:  initialEntryBlockId,
+		contents: checkpointData,
+		ckpCtx:   checkpointContext,
+	}); err != nil {
+		t.Error(err)
+	}
+	if err = writeCheckpoint(cp.bs, cp.db, &writableCheckpoint{
+		blockId:  laterEntryBlockId,
+		contents: checkpointData2,
+		ckpCtx:   checkpointContext,
+	}); err != nil {
+		t.Error(err)
+	}
+
+	tgm := &TimeGetterMock{
+		func(ctx context.Context, height *common.TimeBlocks) (*common.BlockId, error) {
+			switch height.AsInt().Int64() {
+			case 10:
+				return initialEntryBlockId, nil
+			case 15:
+				return laterEntryBlockId, nil
+			default:
+				t.Error("queried height without a checkpoint", height)
+				return nil, errors.New("unexpected height")
+			}
+		},
+	}
+	for height, expected := range map[int64][]byte{
+		12: checkpointData,
+		15: checkpointData2,
+		50: checkpointData2,
+	} {
+		if err = cp.RestoreStateAt(context.Background(), tgm, common.NewTimeBlocksInt(height), func(data []byte, restoreContext ckptcontext.RestoreContext, _ *common.BlockId) error {
+			if !bytes.Equal(data, expected) {
+				t.Error("incorrect checkpoint data restored at height", height)
+			}
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = cp.RestoreStateAt(context.Background(), tgm, common.NewTimeBlocksInt(5), func(data []byte, restoreContext ckptcontext.RestoreContext, _ *common.BlockId) error {
+		t.Error("shouldn't be able to restore")
+		return nil
+	}); err != errNoMatchingCheckpoint {
+		t.Error(err)
+	}
+}
@@ -46,6 +46,29 @@ const (
 	UnknownErrorCode         ResultType = 255
 )
 
+func (r ResultType) String() string {
+	switch r {
+	case ReturnCode:
+		return "Return"
+	case RevertCode:
+		return "Revert"
+	case CongestionCode:
+		return "Congestion"
+	case InsufficientGasFundsCode:
+		return "InsufficientGasFunds"
+	case InsufficientTxFundsCode:
+		return "InsufficientTxFunds"
+	case BadSequenceCode:
+		return "BadSequence"
+	case InvalidMessageFormatCode:
+		return "InvalidMessageFormat"
+	case UnknownErrorCode:
+		return "UnknownError"
+	default:
+		return fmt.Sprintf("ResultType(%d)", int(r))
+	}
+}
+
 type Result interface {
 	AsValue() value.Value
 }
@@ -77,6 +77,8 @@ func encodeAmount(amount *big.Int) ([]byte, error) {
 	mod := big.NewInt(10)
 	zero := big.NewInt(0)
 	exp := byte(0)
+	// Copy amount so that the caller's value isn't modified
+	amount = new(big.Int).Set(amount)
 	for amount.Cmp(zero) > 0 && new(big.Int).Mod(amount, mod).Cmp(zero) == 0 {
 		amount = amount.Div(amount, mod)
 		exp++
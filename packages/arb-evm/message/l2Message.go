@@ -123,6 +123,8 @@ func (l L2Message) AbstractMessage() (AbstractL2Message, error) {
 		return newSignedTransactionFromData(data)
 	case CompressedECDSA:
 		return newCompressedECDSATxFromData(data)
+	case HeartbeatType:
+		return Heartbeat{}, nil
 	default:
 		return nil, errors.New("invalid l2 l2message type")
 	}
@@ -631,3 +633,23 @@ func (t TransactionBatch) AsDataSafe() []byte {
 	}
 	return ret
 }
+
+// Heartbeat is an empty message which lets L2 time and blocks advance when
+// nothing else is being posted to the inbox
+type Heartbeat struct{}
+
+func (h Heartbeat) String() string {
+	return "Heartbeat()"
+}
+
+func (h Heartbeat) L2Type() L2SubType {
+	return HeartbeatType
+}
+
+func (h Heartbeat) AsData() ([]byte, error) {
+	return h.AsDataSafe(), nil
+}
+
+func (h Heartbeat) AsDataSafe() []byte {
+	return []byte{}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"math"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// AddressTransaction is an entry in an account's transaction history along
+// with the transaction's result
+type AddressTransaction struct {
+	txdb.AddressTx
+	Result *evm.TxResult
+}
+
+// GetTransactionsByAddress returns up to limit of the transactions sent by,
+// sent to, or which created the account, most recent first. If before is set,
+// only transactions with lower log indexes are returned
+func (m *Server) GetTransactionsByAddress(account common.Address, before *uint64, limit int) ([]*AddressTransaction, error) {
+	start := uint64(math.MaxUint64)
+	if before != nil {
+		start = *before
+	}
+	entries, err := m.db.GetTransactionsByAddress(account, start, limit)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*AddressTransaction, 0, len(entries))
+	for _, entry := range entries {
+		logVal, err := m.db.GetLog(entry.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		res, err := evm.NewTxResultFromValue(logVal)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, &AddressTransaction{AddressTx: entry, Result: res})
+	}
+	return txs, nil
+}
@@ -96,9 +96,19 @@ func (m *Server) GetBlockCount() uint64 {
 	return id.Height.AsInt().Uint64()
 }
 
+// FinalizedBlockNumber and SafeBlockNumber extend the rpc.BlockNumber tags
+// with the latest block covered by a confirmed node and the latest block
+// covered by an asserted node
+const (
+	FinalizedBlockNumber = rpc.BlockNumber(-3)
+	SafeBlockNumber      = rpc.BlockNumber(-4)
+)
+
 func (m *Server) blockNum(block *rpc.BlockNumber) (uint64, error) {
 	if *block == rpc.LatestBlockNumber || *block == rpc.PendingBlockNumber {
 		return m.GetBlockCount(), nil
+	} else if *block == SafeBlockNumber || *block == FinalizedBlockNumber {
+		return m.FinalityBlockNum(*block)
 	} else if *block >= 0 {
 		return uint64(*block), nil
 	} else {
@@ -106,6 +116,31 @@ func (m *Server) blockNum(block *rpc.BlockNumber) (uint64, error) {
 	}
 }
 
+// FinalityBlockNum resolves SafeBlockNumber or FinalizedBlockNumber to a block
+// height
+func (m *Server) FinalityBlockNum(block rpc.BlockNumber) (uint64, error) {
+	var height *uint64
+	var err error
+	var status string
+	switch block {
+	case SafeBlockNumber:
+		height, err = m.db.SafeBlock()
+		status = "asserted"
+	case FinalizedBlockNumber:
+		height, err = m.db.FinalizedBlock()
+		status = "confirmed"
+	default:
+		return 0, fmt.Errorf("unsupported BlockNumber: %v", block.Int64())
+	}
+	if err != nil {
+		return 0, err
+	}
+	if height == nil {
+		return 0, fmt.Errorf("no blocks have been %v", status)
+	}
+	return *height, nil
+}
+
 func (m *Server) GetOutputMessage(
 	args *evm.GetOutputMessageArgs,
 	reply *evm.GetOutputMessageReply,
@@ -186,7 +221,47 @@ func (m *Server) GetSnapshot(blockHeight uint64) (*snapshot.Snapshot, error) {
 	return m.db.GetSnapshot(inbox.ChainTime{
 		BlockNum:  common.NewTimeBlocks(new(big.Int).SetUint64(blockHeight)),
 		Timestamp: new(big.Int).SetUint64(info.Header.Time),
-	}), nil
+	})
+}
+
+// ReplayTransaction re-executes the request with the given id on top of the
+// state immediately before it was originally executed
+func (m *Server) ReplayTransaction(requestId common.Hash) (*evm.TxResult, error) {
+	val, err := m.db.GetRequest(requestId)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, errors.New("transaction not found")
+	}
+	res, err := evm.NewTxResultFromValue(val)
+	if err != nil {
+		return nil, err
+	}
+
+	height := res.IncomingRequest.ChainTime.BlockNum.AsInt().Uint64()
+	if height == 0 {
+		return nil, errors.New("can't replay transaction in the genesis block")
+	}
+	block, err := m.BlockInfoByNumber(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %v not found", height)
+	}
+	prevSnap, err := m.GetSnapshot(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	if prevSnap == nil {
+		return nil, fmt.Errorf("state before block %v is not available", height)
+	}
+	results, err := m.GetMachineBlockResults(block)
+	if err != nil {
+		return nil, err
+	}
+	return prevSnap.ReplayTransaction(res, results)
 }
 
 func (m *Server) LatestSnapshot() *snapshot.Snapshot {
@@ -201,6 +276,18 @@ func (m *Server) PendingSnapshot() *snapshot.Snapshot {
 	return pending
 }
 
+// PendingBatchResults returns the speculative results of the transactions in
+// the batch currently being assembled
+func (m *Server) PendingBatchResults() []*evm.TxResult {
+	return m.batch.PendingBatchResults()
+}
+
+// PoolContent returns the transactions held by the batcher or nil if they
+// aren't available
+func (m *Server) PoolContent() *batcher.PoolContent {
+	return m.batch.PoolContent()
+}
+
 func (m *Server) PendingTransactionCount(ctx context.Context, account common.Address) *uint64 {
 	return m.batch.PendingTransactionCount(ctx, account)
 }
@@ -241,11 +328,11 @@ func (m *Server) GetLogs(ctx context.Context, blockHash ethcommon.Hash) ([][]*ty
 }
 
 func (m *Server) BloomStatus() (uint64, uint64) {
-	return 0, 0
+	return m.db.BloomStatus()
 }
 
 func (m *Server) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
-	// Currently not implemented
+	m.db.ServiceFilter(ctx, session)
 }
 
 func (m *Server) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
@@ -276,6 +363,10 @@ func (m *Server) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return m.scope.Track(m.db.SubscribeLogsEvent(ch))
 }
 
+func (m *Server) SubscribeDepositEvent(ch chan<- []*txdb.Deposit) event.Subscription {
+	return m.scope.Track(m.db.SubscribeDepositEvent(ch))
+}
+
 func (m *Server) SubscribeBlockProcessingEvent(ch chan<- []*types.Log) event.Subscription {
 	return m.scope.Track(m.db.SubscribeBlockProcessingEvent(ch))
 }
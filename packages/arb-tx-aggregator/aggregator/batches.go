@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// Batch is an inbox message along with the L2 requests that executing it
+// produced
+type Batch struct {
+	Origin   *txdb.InboxMessageOrigin
+	Requests []common.Hash
+}
+
+// L1Origin locates the inbox message that an L2 request came from
+type L1Origin struct {
+	InboxSeqNum *big.Int
+
+	// Origin is nil if the inbox message hasn't been indexed
+	Origin *txdb.InboxMessageOrigin
+
+	ParentRequestId common.Hash
+
+	// IndexInParent is nil if the request wasn't part of a batch
+	IndexInParent *big.Int
+}
+
+// GetBatchByInboxSeqNum returns nil if the inbox message isn't known
+func (m *Server) GetBatchByInboxSeqNum(seqNum *big.Int) (*Batch, error) {
+	origin, err := m.db.GetInboxMessageOrigin(seqNum)
+	if err != nil || origin == nil {
+		return nil, err
+	}
+	requests, err := m.db.GetInboxMessageRequests(seqNum)
+	if err != nil {
+		return nil, err
+	}
+	return &Batch{Origin: origin, Requests: requests}, nil
+}
+
+// GetBatchesByL1Tx returns every inbox message delivered by an L1 transaction
+func (m *Server) GetBatchesByL1Tx(txHash common.Hash) ([]*Batch, error) {
+	seqNums, err := m.db.GetInboxSeqNumsForL1Tx(txHash)
+	if err != nil {
+		return nil, err
+	}
+	batches := make([]*Batch, 0, len(seqNums))
+	for _, seqNum := range seqNums {
+		batch, err := m.GetBatchByInboxSeqNum(seqNum)
+		if err != nil {
+			return nil, err
+		}
+		if batch != nil {
+			batches = append(batches, batch)
+		}
+	}
+	return batches, nil
+}
+
+// GetL1Origin returns nil if the request hasn't been processed
+func (m *Server) GetL1Origin(requestId common.Hash) (*L1Origin, error) {
+	logVal, err := m.db.GetRequest(requestId)
+	if err != nil || logVal == nil {
+		return nil, err
+	}
+	res, err := evm.NewTxResultFromValue(logVal)
+	if err != nil {
+		return nil, err
+	}
+	provenance := res.IncomingRequest.Provenance
+	origin, err := m.db.GetInboxMessageOrigin(provenance.L1SeqNum)
+	if err != nil {
+		return nil, err
+	}
+	return &L1Origin{
+		InboxSeqNum:     provenance.L1SeqNum,
+		Origin:          origin,
+		ParentRequestId: provenance.ParentRequestId,
+		IndexInParent:   provenance.IndexInParent,
+	}, nil
+}
+
+// DepositStatus is an L1 deposit along with its L2 result
+type DepositStatus struct {
+	Origin *txdb.InboxMessageOrigin
+
+	// Deposit is nil until the deposit has been executed on L2
+	Deposit *txdb.Deposit
+}
+
+// GetDepositStatus returns nil if the inbox message isn't a known deposit
+func (m *Server) GetDepositStatus(seqNum *big.Int) (*DepositStatus, error) {
+	origin, err := m.db.GetInboxMessageOrigin(seqNum)
+	if err != nil || origin == nil || !txdb.IsDepositKind(inbox.Type(origin.Kind)) {
+		return nil, err
+	}
+	deposit, err := m.db.GetDeposit(seqNum)
+	if err != nil {
+		return nil, err
+	}
+	return &DepositStatus{Origin: origin, Deposit: deposit}, nil
+}
+
+// GetDepositStatusesForL1Tx returns the status of every deposit made by an L1
+// transaction
+func (m *Server) GetDepositStatusesForL1Tx(txHash common.Hash) ([]*DepositStatus, error) {
+	seqNums, err := m.db.GetInboxSeqNumsForL1Tx(txHash)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*DepositStatus, 0, len(seqNums))
+	for _, seqNum := range seqNums {
+		status, err := m.GetDepositStatus(seqNum)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const (
+	// TxUnknown transactions haven't been seen by either the batcher or the
+	// database
+	TxUnknown = "unknown"
+
+	// TxIncluded transactions have been executed by the machine but no
+	// assertion covering them has been made
+	TxIncluded = "included"
+
+	// TxAsserted transactions are covered by an assertion which hasn't been
+	// confirmed
+	TxAsserted = "asserted"
+
+	// TxConfirmed transactions are covered by a confirmed assertion
+	TxConfirmed = "confirmed"
+)
+
+// TransactionStatus describes how far a transaction has progressed between
+// submission and confirmation. Before inclusion, Stage is the batcher's stage
+// of the transaction
+type TransactionStatus struct {
+	Stage string
+
+	// BatchTxHash is the hash of the L1 transaction which submitted the batch
+	// containing the transaction. It's only available while the batcher still
+	// tracks the batch
+	BatchTxHash *common.Hash
+
+	// BlockNum is the L2 block containing the transaction once it's included
+	BlockNum *big.Int
+
+	Confirmed bool
+}
+
+// GetTransactionStatus combines the batcher's view of a transaction with the
+// results in the database and the confirmation status of the rollup chain
+func (m *Server) GetTransactionStatus(txHash common.Hash) (*TransactionStatus, error) {
+	status := &TransactionStatus{Stage: TxUnknown}
+	if batchStatus := m.batch.TransactionStatus(txHash); batchStatus != nil {
+		status.Stage = batchStatus.Stage.String()
+		if batchStatus.Batch != nil {
+			batchTxHash := batchStatus.Batch.TxHash
+			status.BatchTxHash = &batchTxHash
+		}
+	}
+
+	logVal, logIndex, err := m.db.GetRequestWithIndex(txHash)
+	if err != nil || logVal == nil {
+		return status, err
+	}
+	res, err := evm.NewTxResultFromValue(logVal)
+	if err != nil {
+		return nil, err
+	}
+	status.BlockNum = res.IncomingRequest.ChainTime.BlockNum.AsInt()
+
+	asserted, confirmed := m.db.LogConfirmationCounts()
+	switch {
+	case *logIndex < confirmed:
+		status.Stage = TxConfirmed
+		status.Confirmed = true
+	case *logIndex < asserted:
+		status.Stage = TxAsserted
+	default:
+		status.Stage = TxIncluded
+	}
+	return status, nil
+}
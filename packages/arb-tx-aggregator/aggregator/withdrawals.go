@@ -0,0 +1,71 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// WithdrawalStatus is a withdrawal along with the assertion that sent it to
+// L1. A withdrawal can be claimed on L1 once its assertion is confirmed
+type WithdrawalStatus struct {
+	Withdrawal *txdb.Withdrawal
+
+	// Assertion is nil until the withdrawal has been asserted
+	Assertion *txdb.Assertion
+
+	Confirmed bool
+}
+
+// GetWithdrawals returns the withdrawals made by an L2 transaction if txHash
+// is set, or otherwise the withdrawals to dest
+func (m *Server) GetWithdrawals(txHash *common.Hash, dest *common.Address) ([]*WithdrawalStatus, error) {
+	var withdrawals []*txdb.Withdrawal
+	var err error
+	if txHash != nil {
+		withdrawals, err = m.db.GetWithdrawalsByTx(*txHash)
+	} else if dest != nil {
+		withdrawals, err = m.db.GetWithdrawalsByDest(*dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*WithdrawalStatus, 0, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		if dest != nil {
+			msg, err := withdrawal.Message()
+			if err != nil {
+				return nil, err
+			}
+			if txdb.TransferDest(msg) != *dest {
+				continue
+			}
+		}
+		assertion, confirmed, err := m.db.GetAssertionForLog(withdrawal.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, &WithdrawalStatus{
+			Withdrawal: withdrawal,
+			Assertion:  assertion,
+			Confirmed:  confirmed,
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arbostest
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+func TestEstimateGas(t *testing.T) {
+	chainTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}
+
+	mach, err := cmachine.New(arbos.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := common.RandAddress()
+	sender := common.RandAddress()
+	runMessage(t, mach, initMsg(), chain)
+	depositEth(t, mach, sender, big.NewInt(1000))
+	fib, err := deployContract(t, mach, sender, hexutil.MustDecode(arbostestcontracts.FibonacciBin), big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failedSendAddress, err := deployContract(t, mach, sender, hexutil.MustDecode(arbostestcontracts.FailedSendBin), big.NewInt(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := snapshot.NewSnapshot(mach.Clone(), chainTime, message.ChainAddressToID(chain), big.NewInt(4))
+
+	fibData, err := generateFib(big.NewInt(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeCall := func(dest common.Address, data []byte, gasPrice *big.Int) message.Call {
+		return message.Call{
+			BasicTx: message.BasicTx{
+				MaxGas:      big.NewInt(1000000000),
+				GasPriceBid: gasPrice,
+				DestAddress: dest,
+				Payment:     big.NewInt(0),
+				Data:        data,
+			},
+		}
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		gas, err := snap.EstimateGas(makeCall(fib, fibData, big.NewInt(0)), sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := snap.Call(makeCall(fib, fibData, big.NewInt(0)), sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gas < res.GasUsed.Uint64() {
+			t.Error("estimate", gas, "is below the gas used", res.GasUsed)
+		}
+
+		// The estimate is the lowest limit at which the call succeeds
+		for _, limit := range []uint64{gas, gas - 1} {
+			msg := makeCall(fib, fibData, big.NewInt(0))
+			msg.MaxGas = new(big.Int).SetUint64(limit)
+			res, err := snap.Call(msg, sender)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (res.ResultCode == evm.ReturnCode) != (limit == gas) {
+				t.Error("unexpected result", res.ResultCode, "with gas limit", limit, "and estimate", gas)
+			}
+		}
+	})
+
+	t.Run("RevertAtCap", func(t *testing.T) {
+		failedSend, err := abi.JSON(strings.NewReader(arbostestcontracts.FailedSendABI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := failedSend.Pack("send", common.RandAddress().ToEthAddress())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = snap.EstimateGas(makeCall(failedSendAddress, data, big.NewInt(0)), sender)
+		execErr, ok := err.(*snapshot.ExecutionError)
+		if !ok {
+			t.Fatal("expected execution error, got", err)
+		}
+		if execErr.ResultCode != evm.RevertCode {
+			t.Error("unexpected result code", execErr.ResultCode)
+		}
+	})
+
+	t.Run("BalanceCap", func(t *testing.T) {
+		// The sender can only afford 100 gas, which isn't enough for the call
+		_, err := snap.EstimateGas(makeCall(fib, fibData, big.NewInt(10)), sender)
+		if _, ok := err.(*snapshot.ExecutionError); !ok {
+			t.Fatal("expected call limited by balance to fail, got", err)
+		}
+
+		msg := makeCall(fib, fibData, big.NewInt(10))
+		msg.Payment = big.NewInt(1001)
+		if _, err := snap.EstimateGas(msg, sender); err == nil {
+			t.Error("expected payment above balance to fail")
+		}
+
+		// Without a gas price the same call is only limited by MaxGas
+		if _, err := snap.EstimateGas(makeCall(fib, fibData, big.NewInt(0)), sender); err != nil {
+			t.Error(err)
+		}
+	})
+}
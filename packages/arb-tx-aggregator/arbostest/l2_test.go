@@ -854,3 +854,91 @@ func TestCompressedECDSATx(t *testing.T) {
 	}
 	verifyTxLogs(t, signer, txes, logs)
 }
+
+func TestCompressedECDSATxWithAddressIndex(t *testing.T) {
+	chain := common.RandAddress()
+	mach, err := cmachine.New(arbos.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runMessage(t, mach, initMsg(), chain)
+
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := common.NewAddressFromEth(crypto.PubkeyToAddress(pk.PublicKey))
+	depositEth(t, mach, sender, big.NewInt(1000))
+
+	// Register the destination so that it gets index 1
+	dest := common.RandAddress()
+	registrar := common.RandAddress()
+	results, _ := runMessage(t, mach, makeArbSysTx(snapshot.AddressTableRegisterData(dest), big.NewInt(0)), registrar)
+	if len(results) != 1 {
+		t.Fatal("unexpected result count", len(results))
+	}
+	succeededTxCheck(t, results[0])
+	index := returnedInt(t, results[0])
+
+	tx := types.NewTransaction(0, dest.ToEthAddress(), big.NewInt(10), 100000000000, big.NewInt(0), []byte{})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(message.ChainAddressToID(chain)), pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedTx := message.NewCompressedECDSAFromEth(signedTx)
+	compressedTx.To = message.CompressedAddressIndex{Int: index}
+
+	fullData, err := message.NewCompressedECDSAFromEth(signedTx).AsData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexedData, err := compressedTx.AsData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexedData) >= len(fullData) {
+		t.Error("indexed transaction isn't smaller", len(indexedData), len(fullData))
+	}
+
+	batch, err := message.NewTransactionBatchFromMessages([]message.AbstractL2Message{compressedTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ = runMessage(t, mach, message.NewSafeL2Message(batch), registrar)
+	if len(results) != 1 {
+		t.Fatal("unexpected result count", len(results))
+	}
+	succeededTxCheck(t, results[0])
+	if results[0].IncomingRequest.Sender != sender {
+		t.Error("transaction had incorrect sender", results[0].IncomingRequest.Sender)
+	}
+	if results[0].IncomingRequest.MessageID.ToEthHash() != signedTx.Hash() {
+		t.Error("transaction had incorrect id", results[0].IncomingRequest.MessageID)
+	}
+
+	snap := snapshot.NewSnapshot(mach.Clone(), inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}, message.ChainAddressToID(chain), big.NewInt(4))
+	balance, err := snap.GetBalance(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(10)) != 0 {
+		t.Error("destination had wrong balance", balance)
+	}
+	lookedUp, err := snap.AddressTableIndex(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookedUp == nil || lookedUp.Cmp(index) != 0 {
+		t.Error("snapshot returned wrong index", lookedUp)
+	}
+	unregistered, err := snap.AddressTableIndex(common.RandAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unregistered != nil {
+		t.Error("unregistered address had index", unregistered)
+	}
+}
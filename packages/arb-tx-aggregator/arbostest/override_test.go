@@ -0,0 +1,184 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arbostest
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+func TestStateOverrides(t *testing.T) {
+	chainTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}
+
+	mach, err := cmachine.New(arbos.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := common.RandAddress()
+	sender := common.RandAddress()
+	runMessage(t, mach, initMsg(), chain)
+	contract, err := deployContract(t, mach, sender, hexutil.MustDecode(arbostestcontracts.FibonacciBin), big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depositEth(t, mach, sender, big.NewInt(1000))
+
+	snap := snapshot.NewSnapshot(mach.Clone(), chainTime, message.ChainAddressToID(chain), big.NewInt(1))
+	contractCode, err := snap.GetCode(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	newCode := hexutil.MustDecode("0x600160005260206000f3")
+	key := common.Hash{1}
+	val := common.Hash{2}
+
+	t.Run("NewAccount", func(t *testing.T) {
+		account := common.RandAddress()
+		nonce := uint64(5)
+		overridden := snap.Clone()
+		err := overridden.ApplyOverride(account, snapshot.AccountOverride{
+			Balance:   big.NewInt(500),
+			Nonce:     &nonce,
+			Code:      newCode,
+			StateDiff: map[common.Hash]common.Hash{key: val},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		balance, err := overridden.GetBalance(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(big.NewInt(500)) != 0 {
+			t.Error("wrong balance", balance)
+		}
+		txCount, err := overridden.GetTransactionCount(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txCount.Uint64() != nonce {
+			t.Error("wrong nonce", txCount)
+		}
+		code, err := overridden.GetCode(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(code, newCode) {
+			t.Error("wrong code", hexutil.Encode(code))
+		}
+		storageVal, err := overridden.GetStorageAt(account, new(big.Int).SetBytes(key[:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if storageVal.Cmp(new(big.Int).SetBytes(val[:])) != 0 {
+			t.Error("wrong storage value", storageVal)
+		}
+
+		// Overrides only apply to the overridden snapshot
+		code, err = snap.GetCode(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 0 {
+			t.Error("override modified original snapshot")
+		}
+	})
+
+	t.Run("ExistingAccount", func(t *testing.T) {
+		overridden := snap.Clone()
+		if err := overridden.ApplyOverride(sender, snapshot.AccountOverride{Balance: big.NewInt(400)}); err != nil {
+			t.Fatal(err)
+		}
+		balance, err := overridden.GetBalance(sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(big.NewInt(400)) != 0 {
+			t.Error("wrong balance", balance)
+		}
+
+		nonce := uint64(0)
+		if err := overridden.ApplyOverride(sender, snapshot.AccountOverride{Nonce: &nonce}); err == nil {
+			t.Error("decreased nonce")
+		}
+	})
+
+	t.Run("ExistingContract", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			override snapshot.AccountOverride
+			err      error
+		}{
+			{
+				name:     "SameCode",
+				override: snapshot.AccountOverride{Code: contractCode},
+				err:      nil,
+			},
+			{
+				name:     "NewCode",
+				override: snapshot.AccountOverride{Code: newCode},
+				err:      snapshot.ErrUnsupportedOverride,
+			},
+			{
+				name:     "StateDiff",
+				override: snapshot.AccountOverride{StateDiff: map[common.Hash]common.Hash{key: val}},
+				err:      snapshot.ErrUnsupportedOverride,
+			},
+			{
+				name:     "EmptyState",
+				override: snapshot.AccountOverride{State: map[common.Hash]common.Hash{}},
+				err:      snapshot.ErrUnsupportedOverride,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				err := snap.Clone().ApplyOverride(contract, test.override)
+				if err != test.err {
+					t.Errorf("expected error %v but got %v", test.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("StateAndStateDiff", func(t *testing.T) {
+		err := snap.Clone().ApplyOverride(common.RandAddress(), snapshot.AccountOverride{
+			State:     map[common.Hash]common.Hash{},
+			StateDiff: map[common.Hash]common.Hash{key: val},
+		})
+		if err == nil {
+			t.Error("expected state and stateDiff to be rejected")
+		}
+	})
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arbostest
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+func TestReplayTransaction(t *testing.T) {
+	chainTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}
+
+	mach, err := cmachine.New(arbos.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := common.RandAddress()
+	l1Sender := common.RandAddress()
+	dest := common.RandAddress()
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := common.NewAddressFromEth(crypto.PubkeyToAddress(pk.PublicKey))
+
+	runMessage(t, mach, initMsg(), chain)
+	depositEth(t, mach, sender, big.NewInt(1000))
+	depositEth(t, mach, l1Sender, big.NewInt(1000))
+	failedSendAddress, err := deployContract(t, mach, l1Sender, hexutil.MustDecode(arbostestcontracts.FailedSendBin), big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := snapshot.NewSnapshot(mach.Clone(), chainTime, message.ChainAddressToID(chain), big.NewInt(4))
+
+	failedSend, err := abi.JSON(strings.NewReader(arbostestcontracts.FailedSendABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failedSendData, err := failedSend.Pack("send", dest.ToEthAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	makeTx := func(nonce uint64, to common.Address, data []byte) message.AbstractL2Message {
+		tx := types.NewTransaction(nonce, to.ToEthAddress(), big.NewInt(10), 100000000000, big.NewInt(0), data)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message.NewCompressedECDSAFromEth(signedTx)
+	}
+
+	// The first transaction of the batch reverts, but still uses its nonce.
+	// Both transactions of the batch share an inbox sequence number, so the
+	// id of the contract transaction that follows depends on it being
+	// replayed with its own sequence number
+	batch, err := message.NewTransactionBatchFromMessages([]message.AbstractL2Message{
+		makeTx(0, failedSendAddress, failedSendData),
+		makeTx(1, dest, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractTx := message.ContractTransaction{
+		BasicTx: message.BasicTx{
+			MaxGas:      big.NewInt(100000000000),
+			GasPriceBid: big.NewInt(0),
+			DestAddress: dest,
+			Payment:     big.NewInt(10),
+			Data:        []byte{},
+		},
+	}
+	assertion, _ := mach.ExecuteAssertion(
+		1000000000,
+		[]inbox.InboxMessage{
+			message.NewInboxMessage(message.NewSafeL2Message(batch), sender, big.NewInt(5), chainTime),
+			message.NewInboxMessage(message.NewSafeL2Message(contractTx), l1Sender, big.NewInt(6), chainTime),
+		},
+		0,
+	)
+	results := make([]*evm.TxResult, 0)
+	for _, avmLog := range assertion.ParseLogs() {
+		res, err := evm.NewTxResultFromValue(avmLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+	if len(results) != 3 {
+		t.Fatal("unexpected result count", len(results))
+	}
+	if results[0].ResultCode != evm.RevertCode {
+		t.Fatal("expected first transaction to revert, got", results[0].ResultCode)
+	}
+	for _, res := range results[1:] {
+		if res.ResultCode != evm.ReturnCode {
+			t.Fatal("transaction failed unexpectedly", res.ResultCode)
+		}
+	}
+
+	for i, res := range results {
+		replayed, err := snap.ReplayTransaction(res, results)
+		if err != nil {
+			t.Fatal("failed to replay transaction", i, err)
+		}
+		if replayed.IncomingRequest.MessageID != res.IncomingRequest.MessageID {
+			t.Error("replayed wrong transaction", i)
+		}
+		if replayed.ResultCode != res.ResultCode {
+			t.Error("transaction", i, "replayed with result", replayed.ResultCode, "instead of", res.ResultCode)
+		}
+		if replayed.GasUsed.Cmp(res.GasUsed) != 0 {
+			t.Error("transaction", i, "replayed with gas used", replayed.GasUsed, "instead of", res.GasUsed)
+		}
+	}
+
+	// Replaying must not modify the snapshot it started from
+	balance, err := snap.GetBalance(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(0)) != 0 {
+		t.Error("replay modified the original snapshot")
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+var registrationGas = big.NewInt(1000000)
+
+// maxTrackedAddresses limits the number of unregistered addresses whose usage
+// is counted and the number that are cached as unregistered
+const maxTrackedAddresses = 10000
+
+// AddressTableConfig controls how the batcher uses the ArbOS address table to
+// shrink the transactions it posts to L1
+type AddressTableConfig struct {
+	// RegisterThreshold is the number of batched transactions sent to an
+	// unregistered address after which the batcher registers the address.
+	// Zero disables registration
+	RegisterThreshold int
+
+	// MaxRegistrations is the maximum number of addresses registered in a
+	// single registration message
+	MaxRegistrations int
+
+	// Registrar is the address that batches are submitted from. Registrations
+	// are unsigned transactions from this address so its L2 account
+	// shouldn't be used for anything else
+	Registrar common.Address
+}
+
+func DefaultAddressTableConfig() AddressTableConfig {
+	return AddressTableConfig{
+		RegisterThreshold: 0,
+		MaxRegistrations:  5,
+	}
+}
+
+// SnapshotFetcher provides the latest state that has been included on L1
+type SnapshotFetcher interface {
+	LatestSnapshot() *snapshot.Snapshot
+}
+
+// AddressTable replaces the destination of batched transactions with its
+// index in the ArbOS address table when the address has been registered.
+//
+// Indexes are only looked up in state that has been included on L1, since
+// registrations can never be removed once they've been included. The
+// AddressTable is only accessed while holding the batcher lock, so lookups
+// are cached to avoid calling into ArbOS for every batched transaction
+type AddressTable struct {
+	config    AddressTableConfig
+	snapshots SnapshotFetcher
+
+	// indexes caches every registered address that has been looked up
+	indexes map[ethcommon.Address]*big.Int
+
+	// unregistered caches the addresses that weren't registered in the state
+	// before the inbox message with sequence number unregisteredSeqNum. It's
+	// cleared once newer state is available since they may have been
+	// registered since
+	unregistered       map[ethcommon.Address]bool
+	unregisteredSeqNum *big.Int
+
+	// usage counts the batched transactions sent to each unregistered
+	// address
+	usage map[ethcommon.Address]int
+
+	// requested holds addresses whose registrations have been sent but not
+	// included yet
+	requested map[ethcommon.Address]bool
+	nextNonce *big.Int
+}
+
+func NewAddressTable(config AddressTableConfig, snapshots SnapshotFetcher) *AddressTable {
+	return &AddressTable{
+		config:       config,
+		snapshots:    snapshots,
+		indexes:      make(map[ethcommon.Address]*big.Int),
+		unregistered: make(map[ethcommon.Address]bool),
+		usage:        make(map[ethcommon.Address]int),
+		requested:    make(map[ethcommon.Address]bool),
+	}
+}
+
+// compressBatch converts txes into compressed transactions, using address
+// table indexes for registered destinations, and counts the uses of
+// unregistered destinations. It returns the number of transactions that used
+// an index
+func (t *AddressTable) compressBatch(txes []*types.Transaction) ([]message.AbstractL2Message, int) {
+	batchTxes := make([]message.AbstractL2Message, 0, len(txes))
+	snap := t.latestSnapshot()
+	if snap == nil {
+		for _, tx := range txes {
+			batchTxes = append(batchTxes, message.NewCompressedECDSAFromEth(tx))
+		}
+		return batchTxes, 0
+	}
+
+	compressedCount := 0
+	for _, tx := range txes {
+		compressedTx := message.NewCompressedECDSAFromEth(tx)
+		if dest := tx.To(); dest != nil {
+			index, err := t.lookup(snap, *dest)
+			if err != nil {
+				log.Warn().Err(err).Str("address", dest.Hex()).Msg("failed to look up address table index")
+			}
+			if index != nil {
+				compressedTx.To = message.CompressedAddressIndex{Int: index}
+				compressedCount++
+			} else if t.config.RegisterThreshold > 0 {
+				if len(t.usage) >= maxTrackedAddresses {
+					t.usage = make(map[ethcommon.Address]int)
+				}
+				t.usage[*dest]++
+			}
+		}
+		batchTxes = append(batchTxes, compressedTx)
+	}
+	return batchTxes, compressedCount
+}
+
+// pendingRegistrations returns transactions registering the most used
+// unregistered addresses. They're sent in their own message rather than with
+// the transactions that use the addresses, since indexes are only used once
+// their registration has been included
+func (t *AddressTable) pendingRegistrations() []message.AbstractL2Message {
+	snap := t.latestSnapshot()
+	if snap == nil {
+		return nil
+	}
+	return t.registrations(snap)
+}
+
+// latestSnapshot returns the latest state included on L1, clearing the cache
+// of unregistered addresses if the state has changed since they were looked
+// up
+func (t *AddressTable) latestSnapshot() *snapshot.Snapshot {
+	snap := t.snapshots.LatestSnapshot()
+	if snap == nil {
+		return nil
+	}
+	seqNum := snap.NextInboxSeqNum()
+	if t.unregisteredSeqNum == nil || seqNum.Cmp(t.unregisteredSeqNum) != 0 {
+		t.unregistered = make(map[ethcommon.Address]bool)
+		t.unregisteredSeqNum = seqNum
+	}
+	return snap
+}
+
+// lookup returns the index of address or nil if it isn't registered in snap,
+// which must have been returned by latestSnapshot
+func (t *AddressTable) lookup(snap *snapshot.Snapshot, address ethcommon.Address) (*big.Int, error) {
+	if index, ok := t.indexes[address]; ok {
+		return index, nil
+	}
+	if t.unregistered[address] {
+		return nil, nil
+	}
+	index, err := snap.AddressTableIndex(common.NewAddressFromEth(address))
+	if err != nil {
+		return nil, err
+	}
+	if index == nil {
+		if len(t.unregistered) >= maxTrackedAddresses {
+			t.unregistered = make(map[ethcommon.Address]bool)
+		}
+		t.unregistered[address] = true
+		return nil, nil
+	}
+	t.indexes[address] = index
+	delete(t.usage, address)
+	delete(t.requested, address)
+	return index, nil
+}
+
+// registrations returns transactions registering the most used unregistered
+// addresses that have reached the registration threshold
+func (t *AddressTable) registrations(snap *snapshot.Snapshot) []message.AbstractL2Message {
+	if t.config.RegisterThreshold == 0 {
+		return nil
+	}
+	nonce, err := snap.GetTransactionCount(t.config.Registrar)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get registrar nonce")
+		return nil
+	}
+	if t.nextNonce != nil && nonce.Cmp(t.nextNonce) >= 0 {
+		// Every registration that was sent has been processed, so any
+		// address that is still requested failed to be registered
+		t.requested = make(map[ethcommon.Address]bool)
+	}
+	if t.nextNonce == nil || nonce.Cmp(t.nextNonce) > 0 {
+		t.nextNonce = nonce
+	}
+
+	var hot []ethcommon.Address
+	for address, count := range t.usage {
+		if count >= t.config.RegisterThreshold && !t.requested[address] {
+			hot = append(hot, address)
+		}
+	}
+	if len(hot) == 0 {
+		return nil
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if t.usage[hot[i]] != t.usage[hot[j]] {
+			return t.usage[hot[i]] > t.usage[hot[j]]
+		}
+		return hot[i].Hex() < hot[j].Hex()
+	})
+	if len(hot) > t.config.MaxRegistrations {
+		hot = hot[:t.config.MaxRegistrations]
+	}
+
+	msgs := make([]message.AbstractL2Message, 0, len(hot))
+	for _, address := range hot {
+		msgs = append(msgs, message.Transaction{
+			MaxGas:      registrationGas,
+			GasPriceBid: big.NewInt(0),
+			SequenceNum: new(big.Int).Set(t.nextNonce),
+			DestAddress: common.NewAddressFromEth(arbos.ARB_SYS_ADDRESS),
+			Payment:     big.NewInt(0),
+			Data:        snapshot.AddressTableRegisterData(common.NewAddressFromEth(address)),
+		})
+		t.nextNonce = new(big.Int).Add(t.nextNonce, big.NewInt(1))
+		t.requested[address] = true
+		log.Info().
+			Str("address", address.Hex()).
+			Int("uses", t.usage[address]).
+			Msg("registering address in address table")
+	}
+	return msgs
+}
+
+// sendRegistrations submits a message registering the addresses that
+// reached the registration threshold, if there are any
+func (m *Batcher) sendRegistrations(ctx context.Context, inbox arbbridge.GlobalInboxSender) {
+	registrations := m.addressTable.pendingRegistrations()
+	if len(registrations) == 0 {
+		return
+	}
+	batchTx, err := message.NewTransactionBatchFromMessages(registrations)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create address registration batch")
+		m.addressTable.reset()
+		return
+	}
+	log.Info().Int("count", len(registrations)).Msg("Submitting address registrations")
+	batch := &pendingSentBatch{
+		data:         message.NewSafeL2Message(batchTx).AsData(),
+		registration: true,
+	}
+	m.submitBatch(ctx, inbox, batch)
+	m.pendingSentBatches.PushBack(batch)
+}
+
+// reset forgets registrations that haven't been included. It's called when a
+// batch is abandoned since any registrations it contained were lost
+func (t *AddressTable) reset() {
+	t.requested = make(map[ethcommon.Address]bool)
+	t.nextNonce = nil
+}
@@ -19,6 +19,8 @@ package batcher
 import (
 	"container/list"
 	"context"
+	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -29,12 +31,12 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
 
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
-	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
 )
 
@@ -56,8 +58,11 @@ type batch interface {
 	getAppliedTxes() []*types.Transaction
 	addIncludedTx(tx *types.Transaction) error
 	updateCurrentSnap(pendingSentBatches *list.List)
+	resetSnap(pendingSentBatches *list.List)
 	checkValidForQueue(tx *types.Transaction) error
 	getLatestSnap() *snapshot.Snapshot
+	getAppliedResults() []*evm.TxResult
+	removePendingLogs(logs []*types.Log)
 }
 
 type TransactionBatcher interface {
@@ -70,11 +75,84 @@ type TransactionBatcher interface {
 
 	// Return nil if no pending snapshot is available
 	PendingSnapshot() *snapshot.Snapshot
+
+	// Return the speculative results of the transactions in the batch
+	// currently being assembled or nil if they aren't available
+	PendingBatchResults() []*evm.TxResult
+
+	// Return nil if the contents of the transaction pool aren't available
+	PoolContent() *PoolContent
+
+	// Return nil if the batcher isn't tracking the transaction
+	TransactionStatus(txHash common.Hash) *TxStatus
+}
+
+// PoolContent is a snapshot of all of the transactions the batcher has
+// accepted that aren't yet known to be included on L1
+type PoolContent struct {
+	// Queued contains the transactions waiting to be added to a batch,
+	// sorted by nonce
+	Queued map[ethcommon.Address][]*types.Transaction
+
+	// Pending contains the transactions in the batch currently being
+	// assembled
+	Pending []*types.Transaction
+
+	// Sent contains the batches that are waiting to be included on L1,
+	// including those whose submission will be retried
+	Sent []SentBatch
+
+	// Completed contains the most recent batches that were confirmed or
+	// whose transactions were requeued
+	Completed []SentBatch
+}
+
+// TxStage is how far a transaction has progressed through the batcher
+type TxStage int
+
+const (
+	// TxQueued transactions are waiting to be added to a batch
+	TxQueued TxStage = iota
+
+	// TxPending transactions are in the batch currently being assembled
+	TxPending
+
+	// TxSent transactions are in a batch that has been sent to L1
+	TxSent
+)
+
+func (s TxStage) String() string {
+	switch s {
+	case TxQueued:
+		return "queued"
+	case TxPending:
+		return "pending"
+	case TxSent:
+		return "sent"
+	default:
+		return fmt.Sprintf("TxStage(%d)", int(s))
+	}
 }
 
-type pendingSentBatch struct {
-	txHash common.Hash
-	txes   []*types.Transaction
+type TxStatus struct {
+	Stage TxStage
+
+	// Batch is the batch containing the transaction if it has been sent
+	Batch *SentBatch
+}
+
+type SentBatch struct {
+	// TxHash is the hash of the latest L1 transaction submitting the batch
+	TxHash common.Hash
+
+	// PreviousTxHashes are the hashes of earlier submissions of the batch
+	// which were replaced
+	PreviousTxHashes []common.Hash
+
+	Txes     []*types.Transaction
+	Status   BatchStatus
+	Attempts int
+	GasPrice *big.Int
 }
 
 type Batcher struct {
@@ -85,6 +163,11 @@ type Batcher struct {
 	queuedTxes         *txQueues
 	pendingBatch       batch
 	pendingSentBatches *list.List
+	completedBatches   *list.List
+	submission         SubmissionConfig
+	journal            *Journal
+	addressTable       *AddressTable
+	heartbeat          *Heartbeat
 	newTxFeed          event.Feed
 }
 
@@ -95,6 +178,11 @@ func NewStatefulBatcher(
 	receiptFetcher ethutils.ReceiptFetcher,
 	globalInbox arbbridge.GlobalInbox,
 	maxBatchTime time.Duration,
+	queueConfig QueueConfig,
+	submissionConfig SubmissionConfig,
+	journal *Journal,
+	addressTable *AddressTable,
+	heartbeat *Heartbeat,
 ) *Batcher {
 	signer := types.NewEIP155Signer(message.ChainAddressToID(rollupAddress))
 	return newBatcher(
@@ -103,6 +191,11 @@ func NewStatefulBatcher(
 		receiptFetcher,
 		globalInbox,
 		maxBatchTime,
+		queueConfig,
+		submissionConfig,
+		journal,
+		addressTable,
+		heartbeat,
 		newStatefulBatch(db, maxBatchSize, signer),
 	)
 }
@@ -113,6 +206,11 @@ func NewStatelessBatcher(
 	receiptFetcher ethutils.ReceiptFetcher,
 	globalInbox arbbridge.GlobalInboxSender,
 	maxBatchTime time.Duration,
+	queueConfig QueueConfig,
+	submissionConfig SubmissionConfig,
+	journal *Journal,
+	addressTable *AddressTable,
+	heartbeat *Heartbeat,
 ) *Batcher {
 	return newBatcher(
 		ctx,
@@ -120,6 +218,11 @@ func NewStatelessBatcher(
 		receiptFetcher,
 		globalInbox,
 		maxBatchTime,
+		queueConfig,
+		submissionConfig,
+		journal,
+		addressTable,
+		heartbeat,
 		newStatelessBatch(maxBatchSize),
 	)
 }
@@ -130,16 +233,46 @@ func newBatcher(
 	receiptFetcher ethutils.ReceiptFetcher,
 	globalInbox arbbridge.GlobalInboxSender,
 	maxBatchTime time.Duration,
+	queueConfig QueueConfig,
+	submissionConfig SubmissionConfig,
+	journal *Journal,
+	addressTable *AddressTable,
+	heartbeat *Heartbeat,
 	pendingBatch batch,
 ) *Batcher {
 	server := &Batcher{
 		signer:             types.NewEIP155Signer(message.ChainAddressToID(rollupAddress)),
-		queuedTxes:         newTxQueues(),
+		queuedTxes:         newTxQueues(queueConfig),
 		pendingBatch:       pendingBatch,
 		pendingSentBatches: list.New(),
+		completedBatches:   list.New(),
+		submission:         submissionConfig,
+		journal:            journal,
+		addressTable:       addressTable,
+		heartbeat:          heartbeat,
 	}
 
+	// Restoring from the journal may have to wait for the txdb to catch up
+	// with L1, so it happens in the background. Batches aren't assembled or
+	// checked until it's done since syncing the journal would drop the
+	// transactions that haven't been restored yet
+	restored := make(chan struct{})
 	go func() {
+		defer close(restored)
+		if journal == nil {
+			return
+		}
+		if err := server.restoreFromJournal(ctx, receiptFetcher); err != nil {
+			log.Error().Err(err).Msg("failed to restore transactions from journal")
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-restored:
+		}
 		lastBatch := time.Now()
 		ticker := time.NewTicker(time.Millisecond * 500)
 		defer ticker.Stop()
@@ -150,8 +283,11 @@ func newBatcher(
 
 			case <-ticker.C:
 				server.Lock()
+				if removed := server.queuedTxes.removeExpired(server.pendingBatch, time.Now()); removed > 0 {
+					log.Info().Int("count", removed).Msg("dropped expired queued txes")
+				}
 				for {
-					tx, accountIndex, cont := popRandomTx(server.pendingBatch, server.queuedTxes)
+					tx, accountIndex, cont := popTx(server.pendingBatch, server.queuedTxes)
 					if tx != nil {
 						err := server.pendingBatch.addIncludedTx(tx)
 						server.queuedTxes.maybeRemoveAccountAtIndex(accountIndex)
@@ -166,6 +302,11 @@ func newBatcher(
 					}
 
 					if !cont {
+						if server.heartbeat != nil &&
+							len(server.pendingBatch.getAppliedTxes()) == 0 &&
+							server.heartbeat.due(time.Now()) {
+							server.sendHeartbeat(ctx, globalInbox)
+						}
 						// If we didn't fill the last batch, pause for more transactions
 						server.Unlock()
 						break
@@ -177,6 +318,11 @@ func newBatcher(
 	}()
 
 	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-restored:
+		}
 		ticker := time.NewTicker(maxBatchTime)
 		defer ticker.Stop()
 		for {
@@ -186,29 +332,9 @@ func newBatcher(
 
 			case <-ticker.C:
 				server.Lock()
-				// Note: this loop is the only place where items can be removed
-				// from pendingSentBatches, so pendingSentBatches.Front() is
-				// guaranteed not to change when the server lock is released
-				for server.pendingSentBatches.Len() > 0 {
-					batch := server.pendingSentBatches.Front().Value.(*pendingSentBatch)
-					txHash := batch.txHash.ToEthHash()
-					server.Unlock()
-					receipt, err := ethbridge.WaitForReceiptWithResultsSimple(ctx, receiptFetcher, txHash)
-					if err != nil || receipt.Status != 1 {
-						// batch failed
-						log.Fatal().Err(err).Msg("Error submitted batch")
-					}
-
-					receiptJSON, err := receipt.MarshalJSON()
-					if err != nil {
-						log.Err(err).Msg("failed to generate json for receipt")
-					} else {
-						log.Info().RawJSON("receipt", receiptJSON).Msg("batch receipt")
-					}
-
-					// batch succeeded
-					server.Lock()
-					server.pendingSentBatches.Remove(server.pendingSentBatches.Front())
+				server.checkSentBatches(ctx, globalInbox, receiptFetcher)
+				if err := server.syncJournal(); err != nil {
+					log.Error().Err(err).Msg("failed to sync transaction journal")
 				}
 				server.Unlock()
 			}
@@ -222,30 +348,47 @@ func (m *Batcher) sendBatch(ctx context.Context, inbox arbbridge.GlobalInboxSend
 	if len(txes) == 0 {
 		return
 	}
-	batchTxes := make([]message.AbstractL2Message, 0, len(txes))
-	for _, tx := range txes {
-		batchTxes = append(batchTxes, message.NewCompressedECDSAFromEth(tx))
+	var batchTxes []message.AbstractL2Message
+	indexedCount := 0
+	if m.addressTable != nil {
+		batchTxes, indexedCount = m.addressTable.compressBatch(txes)
+	} else {
+		batchTxes = make([]message.AbstractL2Message, 0, len(txes))
+		for _, tx := range txes {
+			batchTxes = append(batchTxes, message.NewCompressedECDSAFromEth(tx))
+		}
 	}
 	batchTx, err := message.NewTransactionBatchFromMessages(batchTxes)
 	if err != nil {
 		log.Fatal().Err(err).Msg("transaction aggregator failed")
 	}
-	log.Info().Int("txcount", len(batchTxes)).Msg("Submitting batch")
-	txHash, err := inbox.SendL2MessageNoWait(
-		ctx,
-		message.NewSafeL2Message(batchTx).AsData(),
-	)
-
-	if err != nil {
-		log.Fatal().Err(err).Msg("transaction aggregator failed")
-		return
+	if m.heartbeat != nil {
+		m.heartbeat.recordActivity(time.Now())
 	}
-
+	batchData := message.NewSafeL2Message(batchTx).AsData()
+	log.Info().
+		Int("txcount", len(txes)).
+		Int("indexed", indexedCount).
+		Int("size", len(batchData)).
+		Str("ordering", m.queuedTxes.config.ordering().String()).
+		Msg("Submitting batch")
+
+	// If the submission fails, the batch is kept and retried when checking
+	// the status of sent batches
+	batch := &pendingSentBatch{
+		data: batchData,
+		txes: txes,
+		logs: resultLogs(m.pendingBatch.getAppliedResults()),
+	}
+	m.submitBatch(ctx, inbox, batch)
 	m.pendingBatch = m.pendingBatch.newFromExisting()
-	m.pendingSentBatches.PushBack(&pendingSentBatch{
-		txHash: txHash,
-		txes:   txes,
-	})
+	m.pendingSentBatches.PushBack(batch)
+	if m.addressTable != nil {
+		m.sendRegistrations(ctx, inbox)
+	}
+	if err := m.syncJournal(); err != nil {
+		log.Error().Err(err).Msg("failed to sync transaction journal")
+	}
 }
 
 func (m *Batcher) PendingSnapshot() *snapshot.Snapshot {
@@ -255,6 +398,69 @@ func (m *Batcher) PendingSnapshot() *snapshot.Snapshot {
 	return m.pendingBatch.getLatestSnap()
 }
 
+func (m *Batcher) PendingBatchResults() []*evm.TxResult {
+	m.Lock()
+	defer m.Unlock()
+	m.pendingBatch.updateCurrentSnap(m.pendingSentBatches)
+	return m.pendingBatch.getAppliedResults()
+}
+
+func (m *Batcher) PoolContent() *PoolContent {
+	m.Lock()
+	defer m.Unlock()
+	content := &PoolContent{
+		Queued:  make(map[ethcommon.Address][]*types.Transaction),
+		Pending: append([]*types.Transaction{}, m.pendingBatch.getAppliedTxes()...),
+	}
+	for account, q := range m.queuedTxes.queues {
+		content.Queued[account] = q.sortedTxes()
+	}
+	for e := m.pendingSentBatches.Front(); e != nil; e = e.Next() {
+		content.Sent = append(content.Sent, e.Value.(*pendingSentBatch).info())
+	}
+	for e := m.completedBatches.Front(); e != nil; e = e.Next() {
+		content.Completed = append(content.Completed, e.Value.(*pendingSentBatch).info())
+	}
+	return content
+}
+
+// TransactionStatus looks for the transaction in the queues, the batch being
+// assembled, the batches waiting to be included and the recently confirmed
+// batches
+func (m *Batcher) TransactionStatus(txHash common.Hash) *TxStatus {
+	m.Lock()
+	defer m.Unlock()
+	hash := txHash.ToEthHash()
+	for _, q := range m.queuedTxes.queues {
+		for _, tx := range q.txesByNonce {
+			if tx.Hash() == hash {
+				return &TxStatus{Stage: TxQueued}
+			}
+		}
+	}
+	for _, tx := range m.pendingBatch.getAppliedTxes() {
+		if tx.Hash() == hash {
+			return &TxStatus{Stage: TxPending}
+		}
+	}
+	for e := m.pendingSentBatches.Front(); e != nil; e = e.Next() {
+		batch := e.Value.(*pendingSentBatch)
+		if batch.containsTx(hash) {
+			info := batch.info()
+			return &TxStatus{Stage: TxSent, Batch: &info}
+		}
+	}
+	// Transactions from batches that weren't confirmed have been requeued
+	for e := m.completedBatches.Back(); e != nil; e = e.Prev() {
+		batch := e.Value.(*pendingSentBatch)
+		if batch.status == BatchConfirmed && batch.containsTx(hash) {
+			info := batch.info()
+			return &TxStatus{Stage: TxSent, Batch: &info}
+		}
+	}
+	return nil
+}
+
 func (m *Batcher) PendingTransactionCount(_ context.Context, account common.Address) *uint64 {
 	m.Lock()
 	defer m.Unlock()
@@ -267,7 +473,9 @@ func (m *Batcher) PendingTransactionCount(_ context.Context, account common.Addr
 }
 
 // SendTransaction takes a request signed transaction l2message from a client
-// and puts it in a queue to be included in the next transaction batch
+// and puts it in a queue to be included in the next transaction batch. If a
+// transaction from the same sender with the same nonce is still queued, tx
+// replaces it if it pays a sufficiently higher gas price
 func (m *Batcher) SendTransaction(_ context.Context, tx *types.Transaction) error {
 	sender, err := types.Sender(m.signer, tx)
 	if err != nil {
@@ -275,8 +483,6 @@ func (m *Batcher) SendTransaction(_ context.Context, tx *types.Transaction) erro
 		return err
 	}
 
-	m.newTxFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
-
 	txJSON, err := tx.MarshalJSON()
 	if err != nil {
 		log.Err(err).Msg("failed to marshal tx into json")
@@ -284,6 +490,15 @@ func (m *Batcher) SendTransaction(_ context.Context, tx *types.Transaction) erro
 		log.Info().RawJSON("tx", txJSON).Str("sender", sender.Hex()).Msg("user tx")
 	}
 
+	if err := m.queueTransaction(tx, sender); err != nil {
+		return err
+	}
+
+	m.newTxFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	return nil
+}
+
+func (m *Batcher) queueTransaction(tx *types.Transaction, sender ethcommon.Address) error {
 	m.Lock()
 	defer m.Unlock()
 
@@ -293,7 +508,24 @@ func (m *Batcher) SendTransaction(_ context.Context, tx *types.Transaction) erro
 		return err
 	}
 
-	return m.queuedTxes.addTransaction(tx, sender)
+	replaced, err := m.queuedTxes.addTransaction(tx, sender)
+	if err != nil {
+		return err
+	}
+	if m.journal != nil {
+		if err := m.journal.addTransaction(tx); err != nil {
+			log.Error().Err(err).Str("tx", tx.Hash().Hex()).Msg("failed to journal transaction")
+		}
+	}
+	if replaced != nil {
+		log.Info().
+			Str("sender", sender.Hex()).
+			Uint64("nonce", tx.Nonce()).
+			Str("replaced", replaced.Hash().Hex()).
+			Str("replacement", tx.Hash().Hex()).
+			Msg("replaced queued tx")
+	}
+	return nil
 }
 
 func (m *Batcher) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
@@ -17,17 +17,33 @@
 package batcher
 
 import (
+	"bytes"
+	"container/list"
 	"context"
 	"crypto/ecdsa"
 	"errors"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
 	"math/big"
 	"math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -38,6 +54,22 @@ type mock struct {
 	t            *testing.T
 	sentL1Txes   map[common.Hash]bool
 	seenTxesChan chan<- message.CompressedECDSATransaction
+
+	// failSends is the number of upcoming submissions that will fail
+	failSends int
+	// revertSends is the number of upcoming submissions that will revert
+	revertSends int
+	reverted    map[common.Hash]bool
+	// stuckSends is the number of upcoming submissions that will never be
+	// mined
+	stuckSends int
+
+	// nonces holds the L1 nonce of each submission
+	nonces    map[common.Hash]uint64
+	nextNonce uint64
+
+	// registrations holds the address table registrations that were sent
+	registrations []message.Transaction
 }
 
 func newMock(t *testing.T, seenTxesChan chan<- message.CompressedECDSATransaction, txes []*types.Transaction) *mock {
@@ -45,7 +77,47 @@ func newMock(t *testing.T, seenTxesChan chan<- message.CompressedECDSATransactio
 		t:            t,
 		sentL1Txes:   make(map[common.Hash]bool),
 		seenTxesChan: seenTxesChan,
+		reverted:     make(map[common.Hash]bool),
+		nonces:       make(map[common.Hash]uint64),
+	}
+}
+
+func (m *mock) SendL2MessageNoWaitWithGasPrice(ctx context.Context, data []byte, gasPrice *big.Int, nonce *big.Int) (common.Hash, *big.Int, *big.Int, error) {
+	m.Lock()
+	if gasPrice == nil {
+		gasPrice = big.NewInt(100)
+	}
+	if m.failSends > 0 {
+		m.failSends--
+		m.Unlock()
+		return common.Hash{}, nil, nil, errors.New("send failed")
+	}
+	if nonce == nil {
+		nonce = new(big.Int).SetUint64(m.nextNonce)
+		m.nextNonce++
 	}
+	if m.stuckSends > 0 {
+		m.stuckSends--
+		l1Hash := common.RandHash()
+		m.nonces[l1Hash] = nonce.Uint64()
+		m.Unlock()
+		return l1Hash, gasPrice, nonce, nil
+	}
+	if m.revertSends > 0 {
+		m.revertSends--
+		l1Hash := common.RandHash()
+		m.sentL1Txes[l1Hash] = true
+		m.reverted[l1Hash] = true
+		m.nonces[l1Hash] = nonce.Uint64()
+		m.Unlock()
+		return l1Hash, gasPrice, nonce, nil
+	}
+	m.Unlock()
+	l1Hash, err := m.SendL2MessageNoWait(ctx, data)
+	m.Lock()
+	m.nonces[l1Hash] = nonce.Uint64()
+	m.Unlock()
+	return l1Hash, gasPrice, nonce, err
 }
 
 func (m *mock) SendL2MessageNoWait(_ context.Context, data []byte) (common.Hash, error) {
@@ -64,12 +136,18 @@ func (m *mock) SendL2MessageNoWait(_ context.Context, data []byte) (common.Hash,
 		m.t.Error("expected msg to be batch")
 		return l1Hash, nil
 	}
+	registrationCount := 0
 	for _, rawTx := range batch.Transactions {
 		msg, err := message.L2Message{Data: rawTx}.AbstractMessage()
 		if err != nil {
 			m.t.Error(err)
 			continue
 		}
+		if registration, ok := msg.(message.Transaction); ok {
+			m.registrations = append(m.registrations, registration)
+			registrationCount++
+			continue
+		}
 		compressedTx, ok := msg.(message.CompressedECDSATransaction)
 		if !ok {
 			m.t.Error("expected msg to be compressed ecdsa tx")
@@ -77,6 +155,9 @@ func (m *mock) SendL2MessageNoWait(_ context.Context, data []byte) (common.Hash,
 		}
 		m.seenTxesChan <- compressedTx
 	}
+	if registrationCount > 0 && registrationCount < len(batch.Transactions) {
+		m.t.Error("registrations were sent with other transactions")
+	}
 	return l1Hash, nil
 }
 
@@ -87,8 +168,12 @@ func (m *mock) TransactionReceipt(_ context.Context, txHash ethcommon.Hash) (*ty
 	if !ok {
 		return nil, errors.New("tx not sent")
 	}
+	status := uint64(1)
+	if m.reverted[common.NewHashFromEth(txHash)] {
+		status = 0
+	}
 	return &types.Receipt{
-		Status:      1,
+		Status:      status,
 		TxHash:      txHash,
 		GasUsed:     0,
 		BlockNumber: big.NewInt(0),
@@ -150,6 +235,11 @@ func TestStatelessBatcher(t *testing.T) {
 		mock,
 		mock,
 		time.Millisecond*200,
+		DefaultQueueConfig(),
+		DefaultSubmissionConfig(),
+		nil,
+		nil,
+		nil,
 	)
 
 	for _, tx := range txes {
@@ -207,3 +297,916 @@ txFetchLoop:
 		}
 	}
 }
+
+func TestTxQueueReplacement(t *testing.T) {
+	chain := common.RandAddress()
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(pk.PublicKey)
+	makeTx := func(nonce uint64, gasPrice int64) *types.Transaction {
+		tx := types.NewTransaction(nonce, ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(gasPrice), nil)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signedTx
+	}
+
+	queues := newTxQueues(QueueConfig{PriceBump: 10})
+	original := makeTx(0, 100)
+	if _, err := queues.addTransaction(original, sender); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queues.addTransaction(makeTx(1, 100), sender); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queues.addTransaction(makeTx(0, 109), sender); err != core.ErrReplaceUnderpriced {
+		t.Fatal("expected underpriced replacement to be rejected, got", err)
+	}
+	queue := queues.queues[sender]
+	queuedAt := queue.queuedAt[0]
+	replacement := makeTx(0, 110)
+	replaced, err := queues.addTransaction(replacement, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced != original {
+		t.Error("expected original tx to be replaced")
+	}
+	if !queue.queuedAt[0].Equal(queuedAt) {
+		t.Error("replacement reset the queue time")
+	}
+
+	if queue.Pop() != replacement {
+		t.Error("expected replacement tx to be queued")
+	}
+	if tx := queue.Pop(); tx.Nonce() != 1 {
+		t.Error("unexpected nonce", tx.Nonce())
+	}
+	if !queue.Empty() {
+		t.Error("expected queue to be empty")
+	}
+}
+
+func TestTxQueueLimits(t *testing.T) {
+	chain := common.RandAddress()
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	keys := make([]*ecdsa.PrivateKey, 0, 3)
+	for i := 0; i < 3; i++ {
+		pk, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pk)
+	}
+	makeTx := func(pk *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+		tx := types.NewTransaction(nonce, ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(10), nil)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signedTx
+	}
+	addTx := func(queues *txQueues, pk *ecdsa.PrivateKey, nonce uint64) error {
+		_, err := queues.addTransaction(makeTx(pk, nonce), crypto.PubkeyToAddress(pk.PublicKey))
+		return err
+	}
+
+	queues := newTxQueues(QueueConfig{PriceBump: 10, MaxPerAccount: 2, MaxQueued: 3, Lifetime: time.Minute})
+	if err := addTx(queues, keys[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addTx(queues, keys[0], 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := addTx(queues, keys[0], 2); err != ErrAccountQueueFull {
+		t.Fatal("expected account queue to be full, got", err)
+	}
+	// The next nonce of keys[1] is 0, so this transaction is stuck
+	if err := addTx(queues, keys[1], 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := addTx(queues, keys[2], 0); err != ErrQueueFull {
+		t.Fatal("expected queue to be full, got", err)
+	}
+
+	b := &nonceBatch{statelessBatch: newStatelessBatch(maxBatchSize), signer: signer}
+	if removed := queues.removeExpired(b, time.Now()); removed != 0 {
+		t.Error("unexpected txes removed", removed)
+	}
+	// Only the stuck transaction expires
+	if removed := queues.removeExpired(b, time.Now().Add(time.Hour)); removed != 1 {
+		t.Error("unexpected number of txes removed", removed)
+	}
+	if len(queues.accounts) != 1 || queues.count != 2 {
+		t.Error("expected only executable txes to remain after expiry")
+	}
+	if err := addTx(queues, keys[2], 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nonceBatch accepts transactions whose nonce is the next one for their
+// sender, which is always zero
+type nonceBatch struct {
+	*statelessBatch
+	signer types.Signer
+}
+
+func (b *nonceBatch) validateTx(tx *types.Transaction) txResponse {
+	if _, err := types.Sender(b.signer, tx); err != nil {
+		return REMOVE
+	}
+	if tx.Nonce() > 0 {
+		return SKIP
+	}
+	return b.statelessBatch.validateTx(tx)
+}
+
+func TestOrderingPolicies(t *testing.T) {
+	chain := common.RandAddress()
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	gasPrices := []int64{5, 20, 10, 15}
+	txes := make([]*types.Transaction, 0, len(gasPrices))
+	senders := make([]ethcommon.Address, 0, len(gasPrices))
+	for _, gasPrice := range gasPrices {
+		pk, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := types.NewTransaction(0, ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(gasPrice), nil)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txes = append(txes, signedTx)
+		senders = append(senders, crypto.PubkeyToAddress(pk.PublicKey))
+	}
+
+	popAll := func(ordering OrderingPolicy) []*types.Transaction {
+		config := DefaultQueueConfig()
+		config.Ordering = ordering
+		queues := newTxQueues(config)
+		for i, tx := range txes {
+			if _, err := queues.addTransaction(tx, senders[i]); err != nil {
+				t.Fatal(err)
+			}
+			// Make sure arrival times are distinct
+			<-time.After(time.Millisecond)
+		}
+		b := newStatelessBatch(maxBatchSize)
+		var popped []*types.Transaction
+		for {
+			tx, index, cont := popTx(b, queues)
+			if tx == nil {
+				break
+			}
+			if err := b.addIncludedTx(tx); err != nil {
+				t.Fatal(err)
+			}
+			queues.maybeRemoveAccountAtIndex(index)
+			popped = append(popped, tx)
+			if !cont {
+				break
+			}
+		}
+		if len(popped) != len(txes) {
+			t.Fatal("unexpected number of txes popped", len(popped))
+		}
+		return popped
+	}
+
+	for i, tx := range popAll(FIFOOrdering{}) {
+		if tx != txes[i] {
+			t.Error("fifo ordering popped tx", i, "out of order")
+		}
+	}
+
+	for i, tx := range popAll(GasPriceOrdering{}) {
+		if tx.GasPrice().Int64() != []int64{20, 15, 10, 5}[i] {
+			t.Error("gas price ordering popped tx with gas price", tx.GasPrice(), "at index", i)
+		}
+	}
+
+	first := popAll(NewSeededOrdering(42))
+	second := popAll(NewSeededOrdering(42))
+	for i := range first {
+		if first[i] != second[i] {
+			t.Error("seeded ordering wasn't reproducible")
+		}
+	}
+}
+
+func TestBatcherResubmission(t *testing.T) {
+	chain := common.RandAddress()
+	txes, _ := generateTxes(t, chain)
+	seenTxesChan := make(chan message.CompressedECDSATransaction, 1000)
+	mock := newMock(t, seenTxesChan, txes)
+	mock.failSends = 2
+	mock.revertSends = 1
+
+	submissionConfig := DefaultSubmissionConfig()
+	submissionConfig.RetryDelay = time.Millisecond * 100
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batcher := NewStatelessBatcher(
+		ctx,
+		chain,
+		mock,
+		mock,
+		time.Millisecond*200,
+		DefaultQueueConfig(),
+		submissionConfig,
+		nil,
+		nil,
+		nil,
+	)
+
+	for _, tx := range txes {
+		if err := batcher.SendTransaction(context.Background(), tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every transaction should eventually be included in a successful batch
+	// even though the first submissions failed or reverted
+	seenTxes := make(map[ethcommon.Hash]bool)
+	for len(seenTxes) < len(txes) {
+		select {
+		case tx := <-seenTxesChan:
+			ethTx, err := tx.AsEthTx(message.ChainAddressToID(chain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seenTxes[ethTx.Hash()] = true
+		case <-time.After(time.Second * 10):
+			t.Fatal("timed out waiting for txes", len(seenTxes))
+		}
+	}
+
+	<-time.After(time.Millisecond * 500)
+	content := batcher.PoolContent()
+	foundReverted := false
+	for _, batch := range content.Completed {
+		if batch.Status == BatchReverted {
+			foundReverted = true
+		}
+	}
+	if !foundReverted {
+		t.Error("expected reverted batch to be recorded")
+	}
+}
+
+func TestBatcherStuckSubmission(t *testing.T) {
+	chain := common.RandAddress()
+	txes, _ := generateTxes(t, chain)
+	seenTxesChan := make(chan message.CompressedECDSATransaction, 1000)
+	mock := newMock(t, seenTxesChan, txes)
+	mock.stuckSends = 3
+
+	submissionConfig := DefaultSubmissionConfig()
+	submissionConfig.MaxAttempts = 2
+	submissionConfig.ReceiptTimeout = time.Millisecond * 100
+	submissionConfig.RetryDelay = time.Millisecond * 100
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batcher := NewStatelessBatcher(
+		ctx,
+		chain,
+		mock,
+		mock,
+		time.Millisecond*200,
+		DefaultQueueConfig(),
+		submissionConfig,
+		nil,
+		nil,
+		nil,
+	)
+
+	for _, tx := range txes {
+		if err := batcher.SendTransaction(context.Background(), tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every transaction should eventually be included in a successful batch
+	// even though the first batch was abandoned
+	seenTxes := make(map[ethcommon.Hash]bool)
+	for len(seenTxes) < len(txes) {
+		select {
+		case tx := <-seenTxesChan:
+			ethTx, err := tx.AsEthTx(message.ChainAddressToID(chain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seenTxes[ethTx.Hash()] = true
+		case <-time.After(time.Second * 20):
+			t.Fatal("timed out waiting for txes", len(seenTxes))
+		}
+	}
+
+	content := batcher.PoolContent()
+	foundFailed := false
+	mock.Lock()
+	defer mock.Unlock()
+	for _, batch := range append(content.Sent, content.Completed...) {
+		if batch.Status == BatchFailed {
+			foundFailed = true
+		}
+		for _, previous := range batch.PreviousTxHashes {
+			if mock.nonces[previous] != mock.nonces[batch.TxHash] {
+				t.Error("batch was resubmitted with a different nonce")
+			}
+		}
+	}
+	if !foundFailed {
+		t.Error("expected abandoned batch to be recorded")
+	}
+}
+
+// newTestBatcher creates a stateless batcher without starting its background
+// loops so that tests can drive it directly
+func newTestBatcher(chain common.Address, submissionConfig SubmissionConfig) *Batcher {
+	return &Batcher{
+		signer:             types.NewEIP155Signer(message.ChainAddressToID(chain)),
+		queuedTxes:         newTxQueues(DefaultQueueConfig()),
+		pendingBatch:       newStatelessBatch(maxBatchSize),
+		pendingSentBatches: list.New(),
+		completedBatches:   list.New(),
+		submission:         submissionConfig,
+	}
+}
+
+func TestBatcherRequeuesPendingInOrder(t *testing.T) {
+	chain := common.RandAddress()
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txes := make([]*types.Transaction, 0, 2)
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx := types.NewTransaction(nonce, ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(10), nil)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txes = append(txes, signedTx)
+	}
+
+	seenTxesChan := make(chan message.CompressedECDSATransaction, 10)
+	mock := newMock(t, seenTxesChan, txes)
+	mock.revertSends = 1
+	ctx := context.Background()
+	batcher := newTestBatcher(chain, DefaultSubmissionConfig())
+	batcher.Lock()
+	defer batcher.Unlock()
+
+	// The batch containing nonce 0 is sent and reverts while nonce 1 is
+	// waiting in the pending batch
+	if err := batcher.pendingBatch.addIncludedTx(txes[0]); err != nil {
+		t.Fatal(err)
+	}
+	batcher.sendBatch(ctx, mock)
+	if err := batcher.pendingBatch.addIncludedTx(txes[1]); err != nil {
+		t.Fatal(err)
+	}
+	batcher.checkSentBatches(ctx, mock, mock)
+	if len(batcher.pendingBatch.getAppliedTxes()) != 0 {
+		t.Fatal("expected pending batch to be cleared")
+	}
+
+	for {
+		tx, index, cont := popTx(batcher.pendingBatch, batcher.queuedTxes)
+		if tx != nil {
+			if err := batcher.pendingBatch.addIncludedTx(tx); err != nil {
+				t.Fatal(err)
+			}
+			batcher.queuedTxes.maybeRemoveAccountAtIndex(index)
+		}
+		if !cont {
+			break
+		}
+	}
+	batcher.sendBatch(ctx, mock)
+	for i, expected := range txes {
+		select {
+		case tx := <-seenTxesChan:
+			ethTx, err := tx.AsEthTx(message.ChainAddressToID(chain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ethTx.Hash() != expected.Hash() {
+				t.Error("tx", i, "resubmitted out of order with nonce", ethTx.Nonce())
+			}
+		default:
+			t.Fatal("expected tx", i, "to be resubmitted")
+		}
+	}
+}
+
+func TestBatcherRetryFindsMinedSubmission(t *testing.T) {
+	chain := common.RandAddress()
+	txes, _ := generateTxes(t, chain)
+	seenTxesChan := make(chan message.CompressedECDSATransaction, 1000)
+	mock := newMock(t, seenTxesChan, txes)
+	ctx := context.Background()
+	submissionConfig := DefaultSubmissionConfig()
+	submissionConfig.RetryDelay = 0
+	batcher := newTestBatcher(chain, submissionConfig)
+	batcher.Lock()
+	defer batcher.Unlock()
+
+	for _, tx := range txes[:10] {
+		if err := batcher.pendingBatch.addIncludedTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batcher.sendBatch(ctx, mock)
+
+	// The resubmission fails since the first submission was already mined
+	// with the same nonce
+	batch := batcher.pendingSentBatches.Front().Value.(*pendingSentBatch)
+	batch.status = BatchRetrying
+	mock.failSends = 1
+	batcher.checkSentBatches(ctx, mock, mock)
+
+	if batcher.pendingSentBatches.Len() != 0 {
+		t.Fatal("expected mined batch to be finished")
+	}
+	if batch.status != BatchConfirmed {
+		t.Error("unexpected batch status", batch.status)
+	}
+	if batch.attempts != 1 {
+		t.Error("mined batch was resubmitted")
+	}
+	if batcher.queuedTxes.count != 0 {
+		t.Error("transactions of mined batch were requeued")
+	}
+}
+
+// testPendingStateDB records the pending logs sent and removed by a batch
+type testPendingStateDB struct {
+	snap    *snapshot.Snapshot
+	sent    []*types.Log
+	removed []*types.Log
+}
+
+func (db *testPendingStateDB) LatestSnapshot() *snapshot.Snapshot {
+	return db.snap
+}
+
+func (db *testPendingStateDB) SendPendingLogs(logs []*types.Log) {
+	db.sent = append(db.sent, logs...)
+}
+
+func (db *testPendingStateDB) RemovePendingLogs(logs []*types.Log) {
+	db.removed = append(db.removed, logs...)
+}
+
+// newFibonacciSnapshot returns the state of a new chain where the owner of pk
+// deployed the Fibonacci test contract with nonce 0
+func newFibonacciSnapshot(t *testing.T, chain common.Address, pk *ecdsa.PrivateKey) *snapshot.Snapshot {
+	mach, err := cmachine.New(arbos.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}
+	initMsg := message.Init{
+		ChainParams: valprotocol.ChainParams{
+			StakeRequirement: big.NewInt(0),
+			GracePeriod:      common.TimeTicks{Val: big.NewInt(0)},
+		},
+		ExtraConfig: []byte{},
+	}
+	tx := types.NewContractCreation(0, big.NewInt(0), 100000000000, big.NewInt(0), hexutil.MustDecode(arbostestcontracts.FibonacciBin))
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(message.ChainAddressToID(chain)), pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createMsg, err := message.NewL2Message(message.SignedTransaction{Tx: signedTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mach.ExecuteAssertion(
+		1000000000,
+		[]inbox.InboxMessage{
+			message.NewInboxMessage(initMsg, chain, big.NewInt(0), chainTime),
+			message.NewInboxMessage(createMsg, common.NewAddressFromEth(crypto.PubkeyToAddress(pk.PublicKey)), big.NewInt(1), chainTime),
+		},
+		0,
+	)
+	return snapshot.NewSnapshot(mach, chainTime, message.ChainAddressToID(chain), big.NewInt(1))
+}
+
+func TestBatcherRemovesPendingLogs(t *testing.T) {
+	chain := common.RandAddress()
+	signer := types.NewEIP155Signer(message.ChainAddressToID(chain))
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(pk.PublicKey)
+	fib, err := abi.JSON(strings.NewReader(arbostestcontracts.FibonacciABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fibData, err := fib.Pack("generateFib", big.NewInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := crypto.CreateAddress(sender, 0)
+	txes := make([]*types.Transaction, 0, 2)
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		tx := types.NewTransaction(nonce, contract, big.NewInt(0), 100000000000, big.NewInt(0), fibData)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txes = append(txes, signedTx)
+	}
+
+	db := &testPendingStateDB{snap: newFibonacciSnapshot(t, chain, pk)}
+	mock := newMock(t, nil, nil)
+	mock.revertSends = 1
+	ctx := context.Background()
+	batcher := newTestBatcher(chain, DefaultSubmissionConfig())
+	batcher.pendingBatch = newStatefulBatch(db, maxBatchSize, signer)
+	batcher.Lock()
+	defer batcher.Unlock()
+
+	// Each transaction emits a pending log when it's applied
+	if err := batcher.pendingBatch.addIncludedTx(txes[0]); err != nil {
+		t.Fatal(err)
+	}
+	batcher.sendBatch(ctx, mock)
+	if err := batcher.pendingBatch.addIncludedTx(txes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.sent) != 2 {
+		t.Fatal("unexpected pending log count", len(db.sent))
+	}
+	for _, pendingLog := range db.sent {
+		if pendingLog.Address != contract || pendingLog.Removed {
+			t.Error("unexpected pending log", pendingLog)
+		}
+	}
+
+	// The sent batch reverts, so the logs of both the sent and the pending
+	// batch are removed
+	batcher.checkSentBatches(ctx, mock, mock)
+	if len(db.removed) != len(db.sent) {
+		t.Fatal("unexpected removed log count", len(db.removed))
+	}
+	for i, removedLog := range db.removed {
+		if removedLog.TxHash != db.sent[i].TxHash || removedLog.Index != db.sent[i].Index {
+			t.Error("removed log", i, "doesn't match pending log")
+		}
+	}
+	if batcher.queuedTxes.count != 2 {
+		t.Error("expected both transactions to be requeued, got", batcher.queuedTxes.count)
+	}
+}
+
+// testSnapshotFetcher always returns the same snapshot
+type testSnapshotFetcher struct {
+	snap *snapshot.Snapshot
+}
+
+func (f testSnapshotFetcher) LatestSnapshot() *snapshot.Snapshot {
+	return f.snap
+}
+
+func TestAddressRegistrationMessage(t *testing.T) {
+	chain := common.RandAddress()
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txes, _ := generateTxes(t, chain)
+	seenTxesChan := make(chan message.CompressedECDSATransaction, len(txes))
+	mock := newMock(t, seenTxesChan, txes)
+	ctx := context.Background()
+	batcher := newTestBatcher(chain, DefaultSubmissionConfig())
+	batcher.addressTable = NewAddressTable(
+		AddressTableConfig{RegisterThreshold: 2, MaxRegistrations: 5, Registrar: common.RandAddress()},
+		testSnapshotFetcher{snap: newFibonacciSnapshot(t, chain, pk)},
+	)
+	batcher.Lock()
+	defer batcher.Unlock()
+
+	// Every generated transaction is sent to the same unregistered address
+	for _, tx := range txes[:10] {
+		if err := batcher.pendingBatch.addIncludedTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batcher.sendBatch(ctx, mock)
+	if len(seenTxesChan) != 10 {
+		t.Error("unexpected number of batched txes", len(seenTxesChan))
+	}
+	if len(mock.registrations) != 1 {
+		t.Fatal("unexpected registration count", len(mock.registrations))
+	}
+	registration := mock.registrations[0]
+	if registration.DestAddress != common.NewAddressFromEth(arbos.ARB_SYS_ADDRESS) ||
+		!bytes.Equal(registration.Data, snapshot.AddressTableRegisterData(common.NewAddressFromEth(*txes[0].To()))) {
+		t.Error("unexpected registration", registration)
+	}
+
+	// The registrations were sent in their own message after the batch
+	if batcher.pendingSentBatches.Len() != 2 {
+		t.Fatal("unexpected sent batch count", batcher.pendingSentBatches.Len())
+	}
+	registrationBatch := batcher.pendingSentBatches.Back().Value.(*pendingSentBatch)
+	if !registrationBatch.registration || len(registrationBatch.txes) != 0 {
+		t.Error("expected separate registration batch")
+	}
+
+	// The registration is only sent once
+	for _, tx := range txes[10:20] {
+		if err := batcher.pendingBatch.addIncludedTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batcher.sendBatch(ctx, mock)
+	if len(mock.registrations) != 1 || batcher.pendingSentBatches.Len() != 3 {
+		t.Error("registration was sent again")
+	}
+}
+
+func TestBumpGasPrice(t *testing.T) {
+	config := SubmissionConfig{GasPriceBump: 20}
+	if config.bumpGasPrice(nil) != nil {
+		t.Error("expected unknown gas price to stay unknown")
+	}
+	if bumped := config.bumpGasPrice(big.NewInt(100)); bumped.Cmp(big.NewInt(120)) != 0 {
+		t.Error("unexpected bumped gas price", bumped)
+	}
+	if bumped := config.bumpGasPrice(big.NewInt(1)); bumped.Cmp(big.NewInt(2)) != 0 {
+		t.Error("bumped gas price must increase", bumped)
+	}
+}
+
+type includedLookup struct {
+	sync.Mutex
+	requests map[common.Hash]bool
+	latest   *common.BlockId
+}
+
+func (l *includedLookup) GetRequest(requestId common.Hash) (value.Value, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.requests[requestId] {
+		return value.NewInt64Value(0), nil
+	}
+	return nil, nil
+}
+
+func (l *includedLookup) LatestBlockId() *common.BlockId {
+	l.Lock()
+	defer l.Unlock()
+	return l.latest
+}
+
+func (l *includedLookup) setLatest(latest *common.BlockId) {
+	l.Lock()
+	defer l.Unlock()
+	l.latest = latest
+}
+
+func TestJournal(t *testing.T) {
+	chain := common.RandAddress()
+	txes, _ := generateTxes(t, chain)
+	mock := newMock(t, nil, txes)
+	included := &includedLookup{requests: make(map[common.Hash]bool)}
+	journal := NewJournal(rawdb.NewMemoryDatabase(), included)
+
+	for _, tx := range txes[:40] {
+		if err := journal.addTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// txes[0:10] were sent in a batch that was mined, txes[10:20] were sent
+	// in a batch that reverted, txes[20:30] are queued and txes[30:40] were
+	// dropped from the queue
+	mined := common.RandHash()
+	mock.sentL1Txes[mined] = true
+	reverted := common.RandHash()
+	mock.sentL1Txes[reverted] = true
+	mock.reverted[reverted] = true
+
+	sentBatches := []*pendingSentBatch{
+		{txes: txes[0:10], txHash: common.RandHash(), previousTxHashes: []common.Hash{mined}},
+		{txes: txes[10:20], txHash: reverted},
+	}
+	tracked := make(map[ethcommon.Hash]bool)
+	for _, tx := range txes[:30] {
+		tracked[tx.Hash()] = true
+	}
+	if err := journal.sync(tracked, sentBatches); err != nil {
+		t.Fatal(err)
+	}
+
+	// The result of txes[20] is already in the chain
+	included.requests[common.NewHashFromEth(txes[20].Hash())] = true
+
+	// The chain hasn't processed the block the batch was mined in yet so
+	// loading waits for it to catch up
+	journalSyncPollInterval = time.Millisecond * 10
+	type loadResult struct {
+		txes []*types.Transaction
+		err  error
+	}
+	loadChan := make(chan loadResult, 1)
+	go func() {
+		loaded, err := journal.load(context.Background(), mock)
+		loadChan <- loadResult{txes: loaded, err: err}
+	}()
+	select {
+	case <-loadChan:
+		t.Fatal("loaded journal before chain caught up")
+	case <-time.After(time.Millisecond * 100):
+	}
+	included.setLatest(&common.BlockId{
+		Height:     common.NewTimeBlocksInt(0),
+		HeaderHash: common.RandHash(),
+	})
+	var result loadResult
+	select {
+	case result = <-loadChan:
+	case <-time.After(time.Second):
+		t.Fatal("journal didn't load after chain caught up")
+	}
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	loaded := result.txes
+	loadedHashes := make(map[ethcommon.Hash]bool)
+	for _, tx := range loaded {
+		loadedHashes[tx.Hash()] = true
+	}
+	expected := make(map[ethcommon.Hash]bool)
+	for _, tx := range txes[10:20] {
+		expected[tx.Hash()] = true
+	}
+	for _, tx := range txes[21:30] {
+		expected[tx.Hash()] = true
+	}
+	if len(loadedHashes) != len(expected) {
+		t.Fatal("loaded", len(loadedHashes), "transactions but expected", len(expected))
+	}
+	for txHash := range expected {
+		if !loadedHashes[txHash] {
+			t.Error("missing journaled transaction", txHash.Hex())
+		}
+	}
+
+}
+
+type testUpstreamService struct {
+	sync.Mutex
+	txes []ethcommon.Hash
+	err  error
+}
+
+func (s *testUpstreamService) SendRawTransaction(_ context.Context, data hexutil.Bytes) (ethcommon.Hash, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return ethcommon.Hash{}, s.err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return ethcommon.Hash{}, err
+	}
+	s.txes = append(s.txes, tx.Hash())
+	return tx.Hash(), nil
+}
+
+func (s *testUpstreamService) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.txes)
+}
+
+func newTestUpstream(t *testing.T, url string) (*upstream, *testUpstreamService) {
+	service := &testUpstreamService{}
+	server := ethrpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	return newUpstream(url, ethrpc.DialInProc(server)), service
+}
+
+func TestForwarderFailover(t *testing.T) {
+	ctx := context.Background()
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	newTx := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, ethcommon.Address{5}, big.NewInt(0), 100000, big.NewInt(0), nil), signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	down, _ := newTestUpstream(t, "down")
+	down.rpcClient.Close()
+	rejecting, rejectingService := newTestUpstream(t, "rejecting")
+	rejectingService.err = errors.New("transaction rejected")
+	up, upService := newTestUpstream(t, "up")
+
+	forwarder := newForwarder([]*upstream{down, up}, DefaultForwarderConfig())
+	tx := newTx(0)
+	if err := forwarder.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	if upService.count() != 1 {
+		t.Error("transaction wasn't forwarded to healthy upstream")
+	}
+	if down.errorRate == 0 {
+		t.Error("failure wasn't recorded")
+	}
+	if err := forwarder.SendTransaction(ctx, tx); err != core.ErrAlreadyKnown {
+		t.Error("duplicate transaction wasn't rejected", err)
+	}
+
+	// Once an upstream is unhealthy, it's tried last
+	for i := 0; i < 5; i++ {
+		forwarder.record(down, errors.New("failed"), 0)
+	}
+	if candidates := forwarder.candidates(); candidates[0] != up {
+		t.Error("unhealthy upstream wasn't tried last")
+	}
+
+	// Errors returned by an upstream aren't retried on other upstreams
+	forwarder = newForwarder([]*upstream{rejecting, up}, DefaultForwarderConfig())
+	if err := forwarder.SendTransaction(ctx, newTx(1)); err == nil || err.Error() != "transaction rejected" {
+		t.Error("expected upstream error", err)
+	}
+	if upService.count() != 1 {
+		t.Error("rejected transaction was sent to another upstream")
+	}
+	if err := forwarder.SendTransaction(ctx, newTx(1)); err == core.ErrAlreadyKnown {
+		t.Error("rejected transaction was remembered as forwarded")
+	}
+
+	// Broadcasting succeeds if any upstream accepts the transaction
+	up2, up2Service := newTestUpstream(t, "up2")
+	config := DefaultForwarderConfig()
+	config.Broadcast = true
+	forwarder = newForwarder([]*upstream{rejecting, up, up2}, config)
+	if err := forwarder.SendTransaction(ctx, newTx(2)); err != nil {
+		t.Fatal(err)
+	}
+	if upService.count() != 2 || up2Service.count() != 1 {
+		t.Error("transaction wasn't broadcast to every upstream")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	config := HeartbeatConfig{
+		Interval:     time.Minute,
+		Budget:       big.NewInt(1000),
+		BudgetPeriod: time.Hour,
+	}
+	heartbeat := NewHeartbeat(config, nil)
+	start := heartbeat.lastActivity
+
+	if heartbeat.due(start.Add(30 * time.Second)) {
+		t.Error("heartbeat due before interval")
+	}
+	heartbeat.recordActivity(start.Add(30 * time.Second))
+	if heartbeat.due(start.Add(time.Minute)) {
+		t.Error("heartbeat due despite recent batch")
+	}
+	now := start.Add(2 * time.Minute)
+	if !heartbeat.due(now) {
+		t.Fatal("heartbeat not due after idle interval")
+	}
+
+	heartbeat.sent(now)
+	if heartbeat.due(now.Add(5 * time.Minute)) {
+		t.Error("heartbeat due while another is pending")
+	}
+	heartbeat.finished(100, big.NewInt(10))
+	if heartbeat.due(now.Add(5 * time.Minute)) {
+		t.Error("heartbeat due after budget was spent")
+	}
+
+	// The budget is restored in the next period
+	if !heartbeat.due(start.Add(2 * time.Hour)) {
+		t.Error("heartbeat not due after budget period")
+	}
+}
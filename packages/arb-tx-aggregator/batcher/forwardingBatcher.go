@@ -18,44 +18,296 @@ package batcher
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
-	"log"
 )
 
-type Forwarder struct {
+// maxForwardedTxes is the number of recently forwarded transaction hashes
+// remembered to reject duplicates
+const maxForwardedTxes = 10000
+
+// healthDecay is the weight given to the latest request when updating an
+// upstream's error rate and latency
+const healthDecay = 0.2
+
+// ForwarderConfig controls how the forwarder picks between upstream
+// aggregators
+type ForwarderConfig struct {
+	// Broadcast sends each transaction to every upstream instead of only the
+	// healthiest one
+	Broadcast bool
+
+	// MaxErrorRate is the decaying fraction of failed requests above which an
+	// upstream is considered unhealthy
+	MaxErrorRate float64
+
+	// MaxLatency is the decaying average request latency above which an
+	// upstream is considered unhealthy. Zero disables the latency check
+	MaxLatency time.Duration
+
+	// RetryInterval is how long an unhealthy upstream is skipped after its
+	// last failure before being tried again
+	RetryInterval time.Duration
+}
+
+func DefaultForwarderConfig() ForwarderConfig {
+	return ForwarderConfig{
+		Broadcast:     false,
+		MaxErrorRate:  0.5,
+		MaxLatency:    5 * time.Second,
+		RetryInterval: 30 * time.Second,
+	}
+}
+
+type upstream struct {
+	url       string
+	rpcClient *rpc.Client
 	client    *ethclient.Client
+
+	errorRate   float64
+	latency     time.Duration
+	lastFailure time.Time
+}
+
+func newUpstream(url string, client *rpc.Client) *upstream {
+	return &upstream{url: url, rpcClient: client, client: ethclient.NewClient(client)}
+}
+
+func (u *upstream) healthy(config ForwarderConfig, now time.Time) bool {
+	if u.errorRate <= config.MaxErrorRate && (config.MaxLatency == 0 || u.latency <= config.MaxLatency) {
+		return true
+	}
+	return now.Sub(u.lastFailure) >= config.RetryInterval
+}
+
+func (u *upstream) record(config ForwarderConfig, err error, elapsed time.Duration, now time.Time) {
+	sample := 0.0
+	if isUpstreamFailure(err) {
+		sample = 1
+		u.lastFailure = now
+	} else if config.MaxLatency != 0 && elapsed > config.MaxLatency {
+		u.lastFailure = now
+	}
+	u.errorRate += healthDecay * (sample - u.errorRate)
+	u.latency += time.Duration(healthDecay * float64(elapsed-u.latency))
+}
+
+// isUpstreamFailure returns false if err is nil or was returned by the
+// upstream aggregator itself, such as a rejected transaction, since another
+// upstream would respond the same way
+func isUpstreamFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := err.(rpc.Error)
+	return !ok
+}
+
+// Forwarder sends transactions to one or more upstream aggregators. Requests
+// go to the first healthy upstream and fail over to the next one if it can't
+// be reached, or to all of them at once if broadcasting is enabled
+type Forwarder struct {
+	config    ForwarderConfig
 	newTxFeed event.Feed
+
+	sync.Mutex
+	upstreams      []*upstream
+	forwarded      map[ethcommon.Hash]bool
+	forwardedOrder []ethcommon.Hash
 }
 
-func NewForwarder(client *ethclient.Client) *Forwarder {
-	return &Forwarder{client: client}
+func NewForwarder(ctx context.Context, urls []string, config ForwarderConfig) (*Forwarder, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("forwarder requires at least one upstream")
+	}
+	upstreams := make([]*upstream, 0, len(urls))
+	for _, url := range urls {
+		client, err := rpc.DialContext(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, newUpstream(url, client))
+	}
+	return newForwarder(upstreams, config), nil
+}
+
+func newForwarder(upstreams []*upstream, config ForwarderConfig) *Forwarder {
+	return &Forwarder{
+		config:    config,
+		upstreams: upstreams,
+		forwarded: make(map[ethcommon.Hash]bool),
+	}
+}
+
+// candidates returns the healthy upstreams followed by the unhealthy ones
+// which are only used if every healthy upstream fails
+func (b *Forwarder) candidates() []*upstream {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	healthy := make([]*upstream, 0, len(b.upstreams))
+	var unhealthy []*upstream
+	for _, u := range b.upstreams {
+		if u.healthy(b.config, now) {
+			healthy = append(healthy, u)
+		} else {
+			unhealthy = append(unhealthy, u)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (b *Forwarder) record(u *upstream, err error, elapsed time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	u.record(b.config, err, elapsed, time.Now())
+}
+
+// call runs f against each upstream in turn until one doesn't fail
+func (b *Forwarder) call(ctx context.Context, f func(u *upstream) error) error {
+	var err error
+	for _, u := range b.candidates() {
+		start := time.Now()
+		err = f(u)
+		if ctx.Err() != nil {
+			return err
+		}
+		b.record(u, err, time.Since(start))
+		if !isUpstreamFailure(err) {
+			return err
+		}
+		log.Warn().Err(err).Str("upstream", u.url).Msg("upstream aggregator failed")
+	}
+	return err
+}
+
+// broadcast runs f against every upstream concurrently and succeeds if any of
+// them succeed
+func (b *Forwarder) broadcast(ctx context.Context, f func(u *upstream) error) error {
+	b.Lock()
+	upstreams := append([]*upstream{}, b.upstreams...)
+	b.Unlock()
+
+	errs := make([]error, len(upstreams))
+	var wg sync.WaitGroup
+	for i, u := range upstreams {
+		wg.Add(1)
+		go func(i int, u *upstream) {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = f(u)
+			if ctx.Err() == nil {
+				b.record(u, errs[i], time.Since(start))
+			}
+			if isUpstreamFailure(errs[i]) {
+				log.Warn().Err(errs[i]).Str("upstream", u.url).Msg("upstream aggregator failed")
+			}
+		}(i, u)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	// Prefer an error returned by an upstream to a connection failure
+	for _, err := range errs {
+		if !isUpstreamFailure(err) {
+			return err
+		}
+	}
+	return errs[0]
+}
+
+func (b *Forwarder) send(ctx context.Context, f func(u *upstream) error) error {
+	if b.config.Broadcast {
+		return b.broadcast(ctx, f)
+	}
+	return b.call(ctx, f)
+}
+
+// markForwarded returns false if hash has already been forwarded
+func (b *Forwarder) markForwarded(hash ethcommon.Hash) bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.forwarded[hash] {
+		return false
+	}
+	if len(b.forwardedOrder) >= maxForwardedTxes {
+		delete(b.forwarded, b.forwardedOrder[0])
+		b.forwardedOrder = b.forwardedOrder[1:]
+	}
+	b.forwarded[hash] = true
+	b.forwardedOrder = append(b.forwardedOrder, hash)
+	return true
+}
+
+func (b *Forwarder) unmarkForwarded(hash ethcommon.Hash) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.forwarded, hash)
 }
 
 // Return nil if no pending transaction count is available
 func (b *Forwarder) PendingTransactionCount(ctx context.Context, account common.Address) *uint64 {
-	nonce, err := b.client.PendingNonceAt(ctx, account.ToEthAddress())
+	var nonce uint64
+	err := b.call(ctx, func(u *upstream) error {
+		var err error
+		nonce, err = u.client.PendingNonceAt(ctx, account.ToEthAddress())
+		return err
+	})
 	if err != nil {
-		log.Println("Error fetching pending nice")
+		log.Warn().Err(err).Msg("error fetching pending nonce")
 		return nil
 	}
 	return &nonce
 }
 
 func (b *Forwarder) SendTransaction(ctx context.Context, tx *types.Transaction) error {
-	txes := []*types.Transaction{tx}
-	b.newTxFeed.Send(core.NewTxsEvent{Txs: txes})
-	return b.client.SendTransaction(ctx, tx)
+	if !b.markForwarded(tx.Hash()) {
+		return core.ErrAlreadyKnown
+	}
+	err := b.send(ctx, func(u *upstream) error {
+		return u.client.SendTransaction(ctx, tx)
+	})
+	if err != nil {
+		b.unmarkForwarded(tx.Hash())
+		return err
+	}
+	b.newTxFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	return nil
 }
 
 func (b *Forwarder) PendingSnapshot() *snapshot.Snapshot {
 	return nil
 }
 
+func (b *Forwarder) PendingBatchResults() []*evm.TxResult {
+	return nil
+}
+
+func (b *Forwarder) PoolContent() *PoolContent {
+	return nil
+}
+
+func (b *Forwarder) TransactionStatus(common.Hash) *TxStatus {
+	return nil
+}
+
 func (b *Forwarder) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.newTxFeed.Subscribe(ch)
 }
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+// HeartbeatConfig controls when an idle batcher posts heartbeat messages to
+// keep L2 time moving
+type HeartbeatConfig struct {
+	// Interval is how long the inbox must be idle before a heartbeat is sent
+	Interval time.Duration
+
+	// Budget is the maximum amount of wei spent on heartbeats during each
+	// BudgetPeriod. Nil means no limit
+	Budget *big.Int
+
+	BudgetPeriod time.Duration
+}
+
+func DefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		Interval:     5 * time.Minute,
+		Budget:       big.NewInt(100000000000000000),
+		BudgetPeriod: 24 * time.Hour,
+	}
+}
+
+// Heartbeat decides when the batcher should send a heartbeat message. The
+// inbox counts as active whenever the batcher sends a batch or, if snapshots
+// is set, whenever anyone's message is included on L1. The Heartbeat is only
+// accessed while holding the batcher lock
+type Heartbeat struct {
+	config    HeartbeatConfig
+	snapshots SnapshotFetcher
+
+	lastActivity    time.Time
+	lastInboxSeqNum *big.Int
+
+	periodStart time.Time
+	spent       *big.Int
+
+	// pending is set while a heartbeat is waiting to be included on L1
+	pending bool
+}
+
+func NewHeartbeat(config HeartbeatConfig, snapshots SnapshotFetcher) *Heartbeat {
+	now := time.Now()
+	return &Heartbeat{
+		config:       config,
+		snapshots:    snapshots,
+		lastActivity: now,
+		periodStart:  now,
+		spent:        big.NewInt(0),
+	}
+}
+
+func (h *Heartbeat) recordActivity(now time.Time) {
+	h.lastActivity = now
+}
+
+// due returns true if the inbox has been idle for the heartbeat interval and
+// the budget hasn't been spent
+func (h *Heartbeat) due(now time.Time) bool {
+	if h.pending {
+		return false
+	}
+	if h.snapshots != nil {
+		if snap := h.snapshots.LatestSnapshot(); snap != nil {
+			seqNum := snap.NextInboxSeqNum()
+			if h.lastInboxSeqNum == nil || seqNum.Cmp(h.lastInboxSeqNum) != 0 {
+				h.lastInboxSeqNum = seqNum
+				h.lastActivity = now
+			}
+		}
+	}
+	if now.Sub(h.lastActivity) < h.config.Interval {
+		return false
+	}
+	if now.Sub(h.periodStart) >= h.config.BudgetPeriod {
+		h.periodStart = now
+		h.spent = big.NewInt(0)
+	}
+	return h.config.Budget == nil || h.spent.Cmp(h.config.Budget) < 0
+}
+
+func (h *Heartbeat) sent(now time.Time) {
+	h.pending = true
+	h.lastActivity = now
+}
+
+// finished records the cost of a heartbeat once its L1 transaction has been
+// mined or abandoned
+func (h *Heartbeat) finished(gasUsed uint64, gasPrice *big.Int) {
+	h.pending = false
+	if gasPrice != nil {
+		cost := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), gasPrice)
+		h.spent = h.spent.Add(h.spent, cost)
+	}
+}
+
+func (m *Batcher) sendHeartbeat(ctx context.Context, inbox arbbridge.GlobalInboxSender) {
+	log.Info().Str("spent", m.heartbeat.spent.String()).Msg("Submitting heartbeat")
+	batch := &pendingSentBatch{
+		data:      message.NewSafeL2Message(message.Heartbeat{}).AsData(),
+		heartbeat: true,
+	}
+	m.submitBatch(ctx, inbox, batch)
+	m.pendingSentBatches.PushBack(batch)
+	m.heartbeat.sent(time.Now())
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+)
+
+var (
+	journalTxPrefix    = []byte("t")
+	journalBatchPrefix = []byte("b")
+)
+
+// journalSyncPollInterval is how often the journal checks whether the chain
+// has caught up with the batches it's restoring
+var journalSyncPollInterval = time.Millisecond * 500
+
+// RequestLookup finds the result of an L2 transaction that has been
+// included in the chain
+type RequestLookup interface {
+	GetRequest(requestId common.Hash) (value.Value, error)
+
+	// LatestBlockId returns the latest L1 block whose messages have been
+	// processed or nil if none have been
+	LatestBlockId() *common.BlockId
+}
+
+// Journal persists every transaction accepted by the batcher until it is
+// known to be included on L1 so that the batcher can recover its queues
+// after a restart.
+//
+// Transactions are written synchronously when they are accepted. The set of
+// journaled transactions and the L1 transactions submitting each sent batch
+// are synced with the batcher's state whenever a batch is sent or completed.
+type Journal struct {
+	db       ethdb.Database
+	included RequestLookup
+}
+
+type journalBatch struct {
+	L1TxHashes []ethcommon.Hash
+	TxHashes   []ethcommon.Hash
+}
+
+func NewJournal(db ethdb.Database, included RequestLookup) *Journal {
+	return &Journal{
+		db:       db,
+		included: included,
+	}
+}
+
+func journalTxKey(txHash ethcommon.Hash) []byte {
+	return append(append([]byte{}, journalTxPrefix...), txHash.Bytes()...)
+}
+
+func journalBatchKey(index uint64) []byte {
+	key := append([]byte{}, journalBatchPrefix...)
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], index)
+	return append(key, data[:]...)
+}
+
+func (j *Journal) addTransaction(tx *types.Transaction) error {
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	return j.db.Put(journalTxKey(tx.Hash()), data)
+}
+
+// deleteUntracked adds the deletion of every entry with the given prefix
+// whose hash isn't in tracked to batch. If tracked is nil, every entry is
+// deleted
+func (j *Journal) deleteUntracked(batch ethdb.Batch, prefix []byte, tracked map[ethcommon.Hash]bool) error {
+	it := j.db.NewIterator(prefix, nil)
+	defer it.Release()
+	for it.Next() {
+		if tracked != nil && tracked[ethcommon.BytesToHash(it.Key()[len(prefix):])] {
+			continue
+		}
+		if err := batch.Delete(append([]byte{}, it.Key()...)); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// sync removes every transaction that isn't in tracked from the journal and
+// replaces the saved batches with the given sent batches
+func (j *Journal) sync(tracked map[ethcommon.Hash]bool, sentBatches []*pendingSentBatch) error {
+	batch := j.db.NewBatch()
+	if err := j.deleteUntracked(batch, journalTxPrefix, tracked); err != nil {
+		return err
+	}
+	if err := j.deleteUntracked(batch, journalBatchPrefix, nil); err != nil {
+		return err
+	}
+
+	for i, sent := range sentBatches {
+		var entry journalBatch
+		if sent.txHash != (common.Hash{}) {
+			entry.L1TxHashes = append(entry.L1TxHashes, sent.txHash.ToEthHash())
+		}
+		for _, txHash := range sent.previousTxHashes {
+			entry.L1TxHashes = append(entry.L1TxHashes, txHash.ToEthHash())
+		}
+		for _, tx := range sent.txes {
+			entry.TxHashes = append(entry.TxHashes, tx.Hash())
+		}
+		data, err := rlp.EncodeToBytes(entry)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(journalBatchKey(uint64(i)), data); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// load returns the journaled transactions that haven't been included on L1.
+// A transaction is included if a sent batch containing it was mined
+// successfully or if the chain contains its result. The chain is only checked
+// once it has processed the L1 block of every mined batch, since otherwise
+// transactions that were included would be returned
+func (j *Journal) load(ctx context.Context, receiptFetcher ethutils.ReceiptFetcher) ([]*types.Transaction, error) {
+	included := make(map[ethcommon.Hash]bool)
+	var syncBlock *big.Int
+	it := j.db.NewIterator(journalBatchPrefix, nil)
+	for it.Next() {
+		var entry journalBatch
+		if err := rlp.DecodeBytes(it.Value(), &entry); err != nil {
+			it.Release()
+			return nil, err
+		}
+		for _, l1TxHash := range entry.L1TxHashes {
+			receipt, err := receiptFetcher.TransactionReceipt(ctx, l1TxHash)
+			if err != nil || receipt == nil {
+				continue
+			}
+			if receipt.BlockNumber != nil && (syncBlock == nil || receipt.BlockNumber.Cmp(syncBlock) > 0) {
+				syncBlock = receipt.BlockNumber
+			}
+			if receipt.Status == 1 {
+				for _, txHash := range entry.TxHashes {
+					included[txHash] = true
+				}
+				break
+			}
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	if syncBlock != nil {
+		if err := j.waitForBlock(ctx, syncBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	var txes []*types.Transaction
+	it = j.db.NewIterator(journalTxPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(it.Value(), tx); err != nil {
+			log.Warn().Err(err).Msg("skipping invalid journaled transaction")
+			continue
+		}
+		if included[tx.Hash()] {
+			continue
+		}
+		res, err := j.included.GetRequest(common.NewHashFromEth(tx.Hash()))
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			continue
+		}
+		txes = append(txes, tx)
+	}
+	return txes, it.Error()
+}
+
+// waitForBlock waits until the chain has processed the messages of the given
+// L1 block
+func (j *Journal) waitForBlock(ctx context.Context, height *big.Int) error {
+	logged := false
+	for {
+		latest := j.included.LatestBlockId()
+		if latest != nil && latest.Height.AsInt().Cmp(height) >= 0 {
+			return nil
+		}
+		if !logged {
+			log.Info().Str("block", height.String()).Msg("waiting for chain to catch up before restoring journal")
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(journalSyncPollInterval):
+		}
+	}
+}
+
+// restoreFromJournal requeues the transactions that were accepted but not
+// included before the batcher last stopped
+func (m *Batcher) restoreFromJournal(ctx context.Context, receiptFetcher ethutils.ReceiptFetcher) error {
+	txes, err := m.journal.load(ctx, receiptFetcher)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.pendingBatch.updateCurrentSnap(m.pendingSentBatches)
+	restored := 0
+	for _, tx := range txes {
+		if err := m.requeueTransaction(tx); err != nil {
+			log.Info().
+				Err(err).
+				Str("tx", tx.Hash().Hex()).
+				Msg("dropped journaled transaction")
+			continue
+		}
+		restored++
+	}
+	log.Info().Int("count", restored).Msg("restored queued transactions from journal")
+	return m.syncJournal()
+}
+
+// syncJournal updates the journal to match the transactions currently held
+// by the batcher. The caller must hold the batcher lock
+func (m *Batcher) syncJournal() error {
+	if m.journal == nil {
+		return nil
+	}
+	tracked := make(map[ethcommon.Hash]bool)
+	for _, q := range m.queuedTxes.queues {
+		for _, tx := range q.txes {
+			tracked[tx.Hash()] = true
+		}
+	}
+	for _, tx := range m.pendingBatch.getAppliedTxes() {
+		tracked[tx.Hash()] = true
+	}
+	sentBatches := make([]*pendingSentBatch, 0, m.pendingSentBatches.Len())
+	for e := m.pendingSentBatches.Front(); e != nil; e = e.Next() {
+		batch := e.Value.(*pendingSentBatch)
+		for _, tx := range batch.txes {
+			tracked[tx.Hash()] = true
+		}
+		sentBatches = append(sentBatches, batch)
+	}
+	return m.journal.sync(tracked, sentBatches)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// OrderingPolicy decides the order in which transactions from different
+// senders are added to a batch. Transactions from a single sender are always
+// added in nonce order
+type OrderingPolicy interface {
+	fmt.Stringer
+
+	// accountOrder returns indexes into queues.accounts in the order that
+	// the accounts' next transactions should be tried
+	accountOrder(queues *txQueues) []int
+}
+
+var defaultOrdering = NewRandomOrdering()
+
+// ParseOrderingPolicy returns the policy with the given name. The seed is
+// only used by the random policy and a seed of zero gives non-reproducible
+// ordering
+func ParseOrderingPolicy(name string, seed int64) (OrderingPolicy, error) {
+	switch name {
+	case "random":
+		if seed == 0 {
+			return NewRandomOrdering(), nil
+		}
+		return NewSeededOrdering(seed), nil
+	case "fifo":
+		return FIFOOrdering{}, nil
+	case "gasprice":
+		return GasPriceOrdering{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ordering policy %v", name)
+	}
+}
+
+// RandomOrdering starts at a random account and tries each account in turn
+type RandomOrdering struct {
+	rng  *rand.Rand
+	seed *int64
+}
+
+// NewRandomOrdering returns a RandomOrdering using the global random source
+func NewRandomOrdering() *RandomOrdering {
+	return &RandomOrdering{}
+}
+
+// NewSeededOrdering returns a RandomOrdering with its own random source so that
+// the same sequence of transactions always produces the same batches
+func NewSeededOrdering(seed int64) *RandomOrdering {
+	return &RandomOrdering{
+		rng:  rand.New(rand.NewSource(seed)),
+		seed: &seed,
+	}
+}
+
+func (o *RandomOrdering) String() string {
+	if o.seed != nil {
+		return fmt.Sprintf("random(seed=%v)", *o.seed)
+	}
+	return "random"
+}
+
+func (o *RandomOrdering) accountOrder(queues *txQueues) []int {
+	count := len(queues.accounts)
+	var start int
+	if o.rng != nil {
+		start = o.rng.Intn(count)
+	} else {
+		start = rand.Intn(count)
+	}
+	order := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		order = append(order, (start+i)%count)
+	}
+	return order
+}
+
+// FIFOOrdering tries accounts in the order that their next transactions
+// were queued
+type FIFOOrdering struct{}
+
+func (o FIFOOrdering) String() string {
+	return "fifo"
+}
+
+func (o FIFOOrdering) accountOrder(queues *txQueues) []int {
+	order := nonEmptyAccounts(queues)
+	sort.SliceStable(order, func(i, j int) bool {
+		return headQueuedAt(queues, order[i]).Before(headQueuedAt(queues, order[j]))
+	})
+	return order
+}
+
+// GasPriceOrdering tries accounts in decreasing order of the gas price of
+// their next transactions, breaking ties by the time they were queued
+type GasPriceOrdering struct{}
+
+func (o GasPriceOrdering) String() string {
+	return "gasprice"
+}
+
+func (o GasPriceOrdering) accountOrder(queues *txQueues) []int {
+	order := nonEmptyAccounts(queues)
+	sort.SliceStable(order, func(i, j int) bool {
+		priceI := queues.queues[queues.accounts[order[i]]].Peek().GasPrice()
+		priceJ := queues.queues[queues.accounts[order[j]]].Peek().GasPrice()
+		if cmp := priceI.Cmp(priceJ); cmp != 0 {
+			return cmp > 0
+		}
+		return headQueuedAt(queues, order[i]).Before(headQueuedAt(queues, order[j]))
+	})
+	return order
+}
+
+func nonEmptyAccounts(queues *txQueues) []int {
+	order := make([]int, 0, len(queues.accounts))
+	for i, account := range queues.accounts {
+		if !queues.queues[account].Empty() {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func headQueuedAt(queues *txQueues, index int) time.Time {
+	queue := queues.queues[queues.accounts[index]]
+	return queue.queuedAt[queue.Peek().Nonce()]
+}
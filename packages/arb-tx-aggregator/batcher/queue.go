@@ -20,10 +20,74 @@ import (
 	"container/heap"
 	"errors"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
-	"math/rand"
+	"math/big"
+	"sort"
+	"time"
 )
 
+var (
+	// ErrAccountQueueFull is returned if the sender of a transaction already
+	// has the maximum number of queued transactions
+	ErrAccountQueueFull = errors.New("too many queued transactions from sender")
+
+	// ErrQueueFull is returned if the batcher already has the maximum number
+	// of queued transactions
+	ErrQueueFull = errors.New("transaction queue is full")
+)
+
+// QueueConfig controls which transactions the batcher will accept into its
+// queues and how long it will hold them
+type QueueConfig struct {
+	// PriceBump is the minimum percentage by which the gas price of a
+	// transaction must exceed the gas price of a queued transaction with the
+	// same sender and nonce in order to replace it
+	PriceBump uint64
+
+	// MaxPerAccount is the maximum number of transactions that can be queued
+	// for a single sender. Zero means no limit
+	MaxPerAccount int
+
+	// MaxQueued is the maximum number of transactions that can be queued
+	// across all senders. Zero means no limit
+	MaxQueued int
+
+	// Lifetime is the maximum amount of time a transaction that can't be
+	// executed because of a nonce gap can remain queued before it is dropped.
+	// Zero means transactions are never dropped
+	Lifetime time.Duration
+
+	// Ordering decides which account's transaction is added to a batch
+	// next. If nil, accounts are chosen randomly
+	Ordering OrderingPolicy
+}
+
+func (c QueueConfig) ordering() OrderingPolicy {
+	if c.Ordering == nil {
+		return defaultOrdering
+	}
+	return c.Ordering
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		PriceBump:     10,
+		MaxPerAccount: 64,
+		MaxQueued:     4096,
+		Lifetime:      3 * time.Hour,
+		Ordering:      NewRandomOrdering(),
+	}
+}
+
+// canReplace returns true if replacement pays a high enough gas price to
+// replace existing
+func (c QueueConfig) canReplace(existing, replacement *types.Transaction) bool {
+	// replacement.GasPrice() * 100 >= existing.GasPrice() * (100 + PriceBump)
+	threshold := new(big.Int).Mul(existing.GasPrice(), new(big.Int).SetUint64(100+c.PriceBump))
+	return new(big.Int).Mul(replacement.GasPrice(), big.NewInt(100)).Cmp(threshold) >= 0
+}
+
 // An TxHeap is a min-heap of transactions sorted by nonce.
 type TxHeap []*types.Transaction
 
@@ -46,6 +110,7 @@ func (h *TxHeap) Pop() interface{} {
 type txQueue struct {
 	txes        TxHeap
 	txesByNonce map[uint64]*types.Transaction
+	queuedAt    map[uint64]time.Time
 	maxNonce    uint64
 }
 
@@ -53,22 +118,39 @@ func newTxQueue() *txQueue {
 	return &txQueue{
 		txes:        nil,
 		txesByNonce: make(map[uint64]*types.Transaction),
+		queuedAt:    make(map[uint64]time.Time),
 		maxNonce:    0,
 	}
 }
 
-func (q *txQueue) addTransaction(tx *types.Transaction) error {
-	if _, ok := q.txesByNonce[tx.Nonce()]; ok {
-		return errors.New("transaction replacement not supported")
+// addTransaction queues tx, replacing any queued transaction with the same
+// nonce if the config allows it. The replaced transaction is returned
+func (q *txQueue) addTransaction(tx *types.Transaction, config QueueConfig) (*types.Transaction, error) {
+	if existing, ok := q.txesByNonce[tx.Nonce()]; ok {
+		if !config.canReplace(existing, tx) {
+			return nil, core.ErrReplaceUnderpriced
+		}
+		for i, queued := range q.txes {
+			if queued == existing {
+				// The nonce is unchanged so the heap is still ordered
+				q.txes[i] = tx
+				break
+			}
+		}
+		// The replacement keeps the original's queue time so that
+		// replacing a transaction doesn't extend its lifetime
+		q.txesByNonce[tx.Nonce()] = tx
+		return existing, nil
 	}
 
 	q.txesByNonce[tx.Nonce()] = tx
+	q.queuedAt[tx.Nonce()] = time.Now()
 	heap.Push(&q.txes, tx)
 
 	if tx.Nonce() > q.maxNonce {
 		q.maxNonce = tx.Nonce()
 	}
-	return nil
+	return nil, nil
 }
 
 func (q *txQueue) Empty() bool {
@@ -82,33 +164,150 @@ func (q *txQueue) Peek() *types.Transaction {
 func (q *txQueue) Pop() *types.Transaction {
 	tx := heap.Pop(&q.txes).(*types.Transaction)
 	delete(q.txesByNonce, tx.Nonce())
+	delete(q.queuedAt, tx.Nonce())
 	return tx
 }
 
+// firstGappedNonce returns the lowest nonce of the queued transactions that
+// can't be executed yet. The transactions below it are the head transaction,
+// if b would accept it or is only too full, and the transactions that follow
+// it without a nonce gap
+func (q *txQueue) firstGappedNonce(b batch) uint64 {
+	if q.Empty() {
+		return 0
+	}
+	head := q.Peek()
+	switch b.validateTx(head) {
+	case ACCEPT, FULL:
+	default:
+		return 0
+	}
+	nonce := head.Nonce()
+	for {
+		if _, ok := q.txesByNonce[nonce]; !ok {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// removeQueuedBefore drops every transaction with a nonce of at least
+// minNonce that was queued before cutoff and returns the number of
+// transactions dropped
+func (q *txQueue) removeQueuedBefore(cutoff time.Time, minNonce uint64) int {
+	remaining := q.txes[:0]
+	for _, tx := range q.txes {
+		if tx.Nonce() >= minNonce && q.queuedAt[tx.Nonce()].Before(cutoff) {
+			delete(q.txesByNonce, tx.Nonce())
+			delete(q.queuedAt, tx.Nonce())
+		} else {
+			remaining = append(remaining, tx)
+		}
+	}
+	removed := len(q.txes) - len(remaining)
+	if removed == 0 {
+		return 0
+	}
+	q.txes = remaining
+	heap.Init(&q.txes)
+	q.maxNonce = 0
+	for _, tx := range q.txes {
+		if tx.Nonce() > q.maxNonce {
+			q.maxNonce = tx.Nonce()
+		}
+	}
+	return removed
+}
+
+// sortedTxes returns the queued transactions in nonce order
+func (q *txQueue) sortedTxes() []*types.Transaction {
+	txes := make([]*types.Transaction, len(q.txes))
+	copy(txes, q.txes)
+	sort.Sort(TxHeap(txes))
+	return txes
+}
+
 type txQueues struct {
 	queues   map[common.Address]*txQueue
 	accounts []common.Address
+	config   QueueConfig
+	count    int
 }
 
-func newTxQueues() *txQueues {
+func newTxQueues(config QueueConfig) *txQueues {
 	return &txQueues{
 		queues:   make(map[common.Address]*txQueue),
 		accounts: nil,
+		config:   config,
+		count:    0,
+	}
+}
+
+// checkLimits returns an error if queueing another transaction from sender
+// would exceed the configured limits
+func (q *txQueues) checkLimits(sender common.Address) error {
+	accountCount := 0
+	if queue, ok := q.queues[sender]; ok {
+		accountCount = len(queue.txes)
 	}
+	if q.config.MaxPerAccount > 0 && accountCount >= q.config.MaxPerAccount {
+		return ErrAccountQueueFull
+	}
+	if q.config.MaxQueued > 0 && q.count >= q.config.MaxQueued {
+		return ErrQueueFull
+	}
+	return nil
 }
 
-func (q *txQueues) addTransaction(tx *types.Transaction, sender common.Address) error {
+func (q *txQueues) addTransaction(tx *types.Transaction, sender common.Address) (*types.Transaction, error) {
 	queue, ok := q.queues[sender]
+	if ok {
+		if _, ok := queue.txesByNonce[tx.Nonce()]; ok {
+			// Replacing a transaction doesn't change the number queued
+			return queue.addTransaction(tx, q.config)
+		}
+	}
+	if err := q.checkLimits(sender); err != nil {
+		return nil, err
+	}
 	if !ok {
 		queue = newTxQueue()
 		q.queues[sender] = queue
 		q.accounts = append(q.accounts, sender)
 	}
-	return queue.addTransaction(tx)
+	if _, err := queue.addTransaction(tx, q.config); err != nil {
+		return nil, err
+	}
+	q.count++
+	return nil, nil
 }
 
 func (q *txQueues) removeTxFromAccountAtIndex(i int) {
 	q.queues[q.accounts[i]].Pop()
+	q.count--
+}
+
+// removeExpired drops the transactions that have been queued for longer than
+// the configured lifetime and can't be executed on top of b because they're
+// stuck behind a nonce gap. Executable transactions only stay queued while
+// batches are full, so they are kept however long they have been waiting
+func (q *txQueues) removeExpired(b batch, now time.Time) int {
+	if q.config.Lifetime == 0 {
+		return 0
+	}
+	cutoff := now.Add(-q.config.Lifetime)
+	removed := 0
+	for i := 0; i < len(q.accounts); {
+		queue := q.queues[q.accounts[i]]
+		removed += queue.removeQueuedBefore(cutoff, queue.firstGappedNonce(b))
+		if queue.Empty() {
+			q.maybeRemoveAccountAtIndex(i)
+		} else {
+			i++
+		}
+	}
+	q.count -= removed
+	return removed
 }
 
 func (q *txQueues) maybeRemoveAccountAtIndex(i int) {
@@ -120,27 +319,20 @@ func (q *txQueues) maybeRemoveAccountAtIndex(i int) {
 	}
 }
 
-func popRandomTx(b batch, queuedTxes *txQueues) (*types.Transaction, int, bool) {
-	queuedCount := int32(len(queuedTxes.accounts))
-	if queuedCount == 0 {
+// popTx tries the head transaction of each account queue in the order chosen
+// by the configured ordering policy and removes and returns the first one that
+// can be added to the batch. The returned bool is false if no queued
+// transaction could be added
+func popTx(b batch, queuedTxes *txQueues) (*types.Transaction, int, bool) {
+	if len(queuedTxes.accounts) == 0 {
 		return nil, 0, false
 	}
-	index := int(rand.Int31n(queuedCount))
-	first := true
-	lastIndex := index
-	index--
-	for {
-		index++
-		if index == len(queuedTxes.accounts) {
-			index = 0
-		}
-		if !first && index == lastIndex {
-			return nil, 0, false
-		}
-
-		first = false
+	for _, index := range queuedTxes.config.ordering().accountOrder(queuedTxes) {
 		account := queuedTxes.accounts[index]
 		nextAccount := queuedTxes.queues[account]
+		if nextAccount.Empty() {
+			continue
+		}
 		tx := nextAccount.Peek()
 
 		switch b.validateTx(tx) {
@@ -154,4 +346,5 @@ func popRandomTx(b batch, queuedTxes *txQueues) (*types.Transaction, int, bool)
 			return tx, index, true
 		}
 	}
+	return nil, 0, false
 }
@@ -21,22 +21,34 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
-	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
 	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"log"
 )
 
+// pendingStateDB is the part of the txdb that the pending state is built on
+// and that publishes the logs of pending transactions
+type pendingStateDB interface {
+	LatestSnapshot() *snapshot.Snapshot
+	SendPendingLogs(logs []*types.Log)
+	RemovePendingLogs(logs []*types.Log)
+}
+
 type statefulBatch struct {
 	*statelessBatch
-	db       *txdb.TxDB
+	db       pendingStateDB
 	snap     *snapshot.Snapshot
 	txCounts map[common.Address]uint64
 	signer   types.Signer
+
+	// appliedResults holds the results of executing appliedTxes on top of
+	// the pending state
+	appliedResults []*evm.TxResult
 }
 
-func newStatefulBatch(db *txdb.TxDB, maxSize common.StorageSize, signer types.Signer) *statefulBatch {
+func newStatefulBatch(db pendingStateDB, maxSize common.StorageSize, signer types.Signer) *statefulBatch {
 	return &statefulBatch{
 		statelessBatch: newStatelessBatch(maxSize),
 		db:             db,
@@ -85,28 +97,32 @@ func (p *statefulBatch) validateTx(tx *types.Transaction) txResponse {
 	return p.statelessBatch.validateTx(tx)
 }
 
-func snapWithTx(snap *snapshot.Snapshot, tx *types.Transaction, signer types.Signer) (*snapshot.Snapshot, error) {
+func snapWithTx(snap *snapshot.Snapshot, tx *types.Transaction, signer types.Signer) (*snapshot.Snapshot, *evm.TxResult, error) {
 	msg, err := message.NewL2Message(message.SignedTransaction{Tx: tx})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	sender, err := types.Sender(signer, tx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	_, err = snap.AddMessage(msg, arbcommon.NewAddressFromEth(sender), arbcommon.NewHashFromEth(tx.Hash()))
-	return snap, err
+	res, err := snap.AddMessage(msg, arbcommon.NewAddressFromEth(sender), arbcommon.NewHashFromEth(tx.Hash()))
+	return snap, res, err
 }
 
 func (p *statefulBatch) getLatestSnap() *snapshot.Snapshot {
 	return p.snap
 }
 
+func (p *statefulBatch) getAppliedResults() []*evm.TxResult {
+	return p.appliedResults
+}
+
 func (p *statefulBatch) addIncludedTx(tx *types.Transaction) error {
 	newSnap := p.snap.Clone()
-	newSnap, err := snapWithTx(newSnap, tx, p.signer)
+	newSnap, res, err := snapWithTx(newSnap, tx, p.signer)
 	if err != nil {
 		return err
 	}
@@ -122,9 +138,19 @@ func (p *statefulBatch) addIncludedTx(tx *types.Transaction) error {
 
 	p.snap = newSnap
 	p.txCounts[sender] = tx.Nonce() + 1
+	p.appliedResults = append(p.appliedResults, res)
+	if logs := res.EthLogs(arbcommon.Hash{}); len(logs) > 0 {
+		p.db.SendPendingLogs(logs)
+	}
 	return nil
 }
 
+func (p *statefulBatch) removePendingLogs(logs []*types.Log) {
+	if len(logs) > 0 {
+		p.db.RemovePendingLogs(logs)
+	}
+}
+
 func (p *statefulBatch) checkValidForQueue(tx *types.Transaction) error {
 	ethSender, err := types.Sender(p.signer, tx)
 	if err != nil {
@@ -155,30 +181,44 @@ func (p *statefulBatch) checkValidForQueue(tx *types.Transaction) error {
 func (p *statefulBatch) updateCurrentSnap(pendingSentBatches *list.List) {
 	snap := p.db.LatestSnapshot().Clone()
 	if p.snap.Height().Cmp(snap.Height()) < 0 {
-		// Add all of the already broadcast transactions to the snapshot
-		// If they were already included, they'll be ignored because they will
-		// have invalid sequence numbers
-		n := pendingSentBatches.Front()
-		for n != nil {
-			item := n.Value.(*pendingSentBatch)
-			for _, tx := range item.txes {
-				var err error
-				newSnap, err := snapWithTx(snap, tx, p.signer)
-				if err != nil {
-					continue
-				}
-				snap = newSnap
-			}
-			n = n.Next()
-		}
-		for _, tx := range p.appliedTxes {
+		p.rebuildSnap(snap, pendingSentBatches)
+	}
+}
+
+// resetSnap rebuilds the pending state even if no new blocks have been
+// processed. This is necessary when sent batches are abandoned
+func (p *statefulBatch) resetSnap(pendingSentBatches *list.List) {
+	p.rebuildSnap(p.db.LatestSnapshot().Clone(), pendingSentBatches)
+	p.txCounts = make(map[common.Address]uint64)
+}
+
+func (p *statefulBatch) rebuildSnap(snap *snapshot.Snapshot, pendingSentBatches *list.List) {
+	// Add all of the already broadcast transactions to the snapshot
+	// If they were already included, they'll be ignored because they will
+	// have invalid sequence numbers
+	n := pendingSentBatches.Front()
+	for n != nil {
+		item := n.Value.(*pendingSentBatch)
+		for _, tx := range item.txes {
 			var err error
-			newSnap, err := snapWithTx(snap, tx, p.signer)
+			newSnap, _, err := snapWithTx(snap, tx, p.signer)
 			if err != nil {
 				continue
 			}
 			snap = newSnap
 		}
-		p.snap = snap
+		n = n.Next()
+	}
+	results := make([]*evm.TxResult, 0, len(p.appliedTxes))
+	for _, tx := range p.appliedTxes {
+		var err error
+		newSnap, res, err := snapWithTx(snap, tx, p.signer)
+		if err != nil {
+			continue
+		}
+		snap = newSnap
+		results = append(results, res)
 	}
+	p.snap = snap
+	p.appliedResults = results
 }
@@ -20,6 +20,7 @@ import (
 	"container/list"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
 )
 
@@ -60,10 +61,22 @@ func (p *statelessBatch) updateCurrentSnap(*list.List) {
 
 }
 
+func (p *statelessBatch) resetSnap(*list.List) {
+
+}
+
 func (p *statelessBatch) getLatestSnap() *snapshot.Snapshot {
 	return nil
 }
 
+func (p *statelessBatch) getAppliedResults() []*evm.TxResult {
+	return nil
+}
+
+func (p *statelessBatch) removePendingLogs([]*types.Log) {
+
+}
+
 func (p *statelessBatch) addIncludedTx(tx *types.Transaction) error {
 	p.appliedTxes = append(p.appliedTxes, tx)
 	p.sizeBytes += tx.Size()
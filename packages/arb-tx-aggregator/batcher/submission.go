@@ -0,0 +1,407 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+)
+
+// maxCompletedBatches is the number of finished batches whose status is kept
+// after they are removed from pendingSentBatches
+const maxCompletedBatches = 100
+
+// SubmissionConfig controls how the batcher handles batches that fail to be
+// included on L1
+type SubmissionConfig struct {
+	// GasPriceBump is the percentage by which the L1 gas price is increased
+	// each time a batch is resubmitted
+	GasPriceBump uint64
+
+	// MaxAttempts is the number of times a batch will be submitted before
+	// giving up and requeuing its transactions
+	MaxAttempts int
+
+	// ReceiptTimeout is how long to wait for a submitted batch to be mined
+	// before resubmitting it
+	ReceiptTimeout time.Duration
+
+	// RetryDelay is how long to wait before retrying a submission that
+	// failed to be sent
+	RetryDelay time.Duration
+}
+
+func DefaultSubmissionConfig() SubmissionConfig {
+	return SubmissionConfig{
+		GasPriceBump:   20,
+		MaxAttempts:    5,
+		ReceiptTimeout: 5 * time.Minute,
+		RetryDelay:     10 * time.Second,
+	}
+}
+
+func (c SubmissionConfig) bumpGasPrice(gasPrice *big.Int) *big.Int {
+	if gasPrice == nil {
+		return nil
+	}
+	bumped := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(100+c.GasPriceBump))
+	bumped = bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(gasPrice) <= 0 {
+		bumped = bumped.Add(gasPrice, big.NewInt(1))
+	}
+	return bumped
+}
+
+type BatchStatus int
+
+const (
+	// BatchSubmitted batches are waiting to be mined on L1
+	BatchSubmitted BatchStatus = iota
+
+	// BatchRetrying batches failed to be sent and will be sent again
+	BatchRetrying
+
+	// BatchConfirmed batches were successfully included on L1
+	BatchConfirmed
+
+	// BatchReverted batches were mined but reverted. Their transactions
+	// were requeued
+	BatchReverted
+
+	// BatchFailed batches couldn't be included after the maximum number of
+	// attempts. Their transactions were requeued
+	BatchFailed
+)
+
+func (s BatchStatus) String() string {
+	switch s {
+	case BatchSubmitted:
+		return "submitted"
+	case BatchRetrying:
+		return "retrying"
+	case BatchConfirmed:
+		return "confirmed"
+	case BatchReverted:
+		return "reverted"
+	case BatchFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("BatchStatus(%d)", int(s))
+	}
+}
+
+type pendingSentBatch struct {
+	data []byte
+	txes []*types.Transaction
+	// logs were sent to pending log subscribers when txes were applied and
+	// are removed if the batch isn't confirmed
+	logs []*types.Log
+
+	// heartbeat is set if the batch is a heartbeat message
+	heartbeat bool
+	// registration is set if the batch only registers addresses in the
+	// address table
+	registration bool
+	gasUsed      uint64
+
+	// txHash is the hash of the latest L1 transaction containing this batch
+	// and is zero if no submission has succeeded
+	txHash           common.Hash
+	previousTxHashes []common.Hash
+	gasPrice         *big.Int
+
+	// nonce is the L1 nonce of the first successful submission and is nil
+	// until then. Resubmissions reuse it so that they replace the earlier
+	// submissions and at most one of them can be mined
+	nonce *big.Int
+
+	status      BatchStatus
+	attempts    int
+	lastAttempt time.Time
+}
+
+func (b *pendingSentBatch) info() SentBatch {
+	return SentBatch{
+		TxHash:           b.txHash,
+		PreviousTxHashes: append([]common.Hash{}, b.previousTxHashes...),
+		Txes:             append([]*types.Transaction{}, b.txes...),
+		Status:           b.status,
+		Attempts:         b.attempts,
+		GasPrice:         b.gasPrice,
+	}
+}
+
+// submittedTxHashes returns the hashes of every successful submission of
+// the batch
+func (b *pendingSentBatch) submittedTxHashes() []common.Hash {
+	if b.txHash == (common.Hash{}) {
+		return b.previousTxHashes
+	}
+	return append([]common.Hash{b.txHash}, b.previousTxHashes...)
+}
+
+func (b *pendingSentBatch) containsTx(hash ethcommon.Hash) bool {
+	for _, tx := range b.txes {
+		if tx.Hash() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// submitBatch sends the batch to L1, bumping the gas price and reusing the
+// nonce if it was already submitted. If sending fails, the batch is marked
+// for retry
+func (m *Batcher) submitBatch(ctx context.Context, inbox arbbridge.GlobalInboxSender, batch *pendingSentBatch) {
+	gasPrice := m.submission.bumpGasPrice(batch.gasPrice)
+	batch.attempts++
+	batch.lastAttempt = time.Now()
+	txHash, usedGasPrice, nonce, err := inbox.SendL2MessageNoWaitWithGasPrice(ctx, batch.data, gasPrice, batch.nonce)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Int("attempt", batch.attempts).
+			Int("txcount", len(batch.txes)).
+			Msg("failed to submit batch")
+		batch.status = BatchRetrying
+		return
+	}
+	if batch.txHash != (common.Hash{}) {
+		batch.previousTxHashes = append(batch.previousTxHashes, batch.txHash)
+	}
+	batch.txHash = txHash
+	batch.gasPrice = usedGasPrice
+	batch.nonce = nonce
+	batch.status = BatchSubmitted
+	log.Info().
+		Str("txhash", txHash.String()).
+		Str("gasprice", usedGasPrice.String()).
+		Str("nonce", nonce.String()).
+		Int("attempt", batch.attempts).
+		Msg("submitted batch")
+}
+
+// checkSentBatches waits for the receipts of sent batches in the order they
+// were sent. Batches that aren't mined in time are resubmitted with a higher
+// gas price and the transactions of batches that revert or exhaust their
+// attempts are requeued. The caller must hold the batcher lock, which is
+// released while waiting for receipts
+func (m *Batcher) checkSentBatches(
+	ctx context.Context,
+	inbox arbbridge.GlobalInboxSender,
+	receiptFetcher ethutils.ReceiptFetcher,
+) {
+	// Note: this loop is the only place where items can be removed
+	// from pendingSentBatches, so pendingSentBatches.Front() is
+	// guaranteed not to change when the server lock is released
+	for m.pendingSentBatches.Len() > 0 {
+		batch := m.pendingSentBatches.Front().Value.(*pendingSentBatch)
+		if batch.status == BatchRetrying {
+			if time.Since(batch.lastAttempt) < m.submission.RetryDelay {
+				return
+			}
+			if batch.nonce != nil {
+				// Resubmissions reuse the nonce, so they can only fail if an
+				// earlier submission was already mined
+				m.Unlock()
+				receipt := findReceipt(ctx, receiptFetcher, batch.submittedTxHashes())
+				m.Lock()
+				if ctx.Err() != nil {
+					return
+				}
+				if receipt != nil {
+					m.finishMinedBatch(receipt)
+					continue
+				}
+			}
+			if batch.attempts >= m.submission.MaxAttempts {
+				m.abandonFrontBatch()
+				continue
+			}
+			m.submitBatch(ctx, inbox, batch)
+			if batch.status == BatchRetrying {
+				return
+			}
+		}
+
+		txHash := batch.txHash.ToEthHash()
+		m.Unlock()
+		waitCtx, cancel := context.WithTimeout(ctx, m.submission.ReceiptTimeout)
+		receipt, err := ethbridge.WaitForReceiptWithResultsSimple(waitCtx, receiptFetcher, txHash)
+		cancel()
+		if err != nil {
+			// One of the earlier submissions may have been mined instead
+			receipt = findReceipt(ctx, receiptFetcher, batch.previousTxHashes)
+		}
+		m.Lock()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if receipt == nil {
+			log.Warn().
+				Err(err).
+				Str("txhash", txHash.Hex()).
+				Int("attempt", batch.attempts).
+				Msg("batch wasn't mined in time")
+			if batch.attempts >= m.submission.MaxAttempts {
+				m.abandonFrontBatch()
+				continue
+			}
+			m.submitBatch(ctx, inbox, batch)
+			continue
+		}
+
+		m.finishMinedBatch(receipt)
+	}
+}
+
+// finishMinedBatch completes the oldest sent batch, one of whose submissions
+// was mined with the given receipt
+func (m *Batcher) finishMinedBatch(receipt *types.Receipt) {
+	receiptJSON, err := receipt.MarshalJSON()
+	if err != nil {
+		log.Err(err).Msg("failed to generate json for receipt")
+	} else {
+		log.Info().RawJSON("receipt", receiptJSON).Msg("batch receipt")
+	}
+
+	batch := m.pendingSentBatches.Front().Value.(*pendingSentBatch)
+	batch.gasUsed = receipt.GasUsed
+	if receipt.Status != 1 {
+		m.finishFrontBatch(BatchReverted)
+	} else {
+		m.finishFrontBatch(BatchConfirmed)
+	}
+}
+
+// abandonFrontBatch gives up on the oldest sent batch after it exhausted its
+// attempts. If it was ever submitted, every later batch was sent with a
+// higher L1 nonce and can't be mined until its nonce is used, so the later
+// batches are abandoned too and all of their transactions are requeued in
+// order. If one of the abandoned submissions is mined after all, ArbOS
+// rejects the duplicate transactions since their nonces were already used
+func (m *Batcher) abandonFrontBatch() {
+	batch := m.pendingSentBatches.Front().Value.(*pendingSentBatch)
+	m.finishFrontBatch(BatchFailed)
+	if batch.nonce == nil {
+		return
+	}
+	for m.pendingSentBatches.Len() > 0 {
+		m.finishFrontBatch(BatchFailed)
+	}
+}
+
+// finishFrontBatch removes the oldest sent batch, recording its final status,
+// and requeues its transactions unless it was confirmed. The transactions of
+// the pending batch are requeued too since they may follow the requeued ones
+// and must be re-applied in nonce order
+func (m *Batcher) finishFrontBatch(status BatchStatus) {
+	batch := m.pendingSentBatches.Remove(m.pendingSentBatches.Front()).(*pendingSentBatch)
+	batch.status = status
+	m.completedBatches.PushBack(batch)
+	if m.completedBatches.Len() > maxCompletedBatches {
+		m.completedBatches.Remove(m.completedBatches.Front())
+	}
+	if batch.heartbeat {
+		if m.heartbeat != nil {
+			m.heartbeat.finished(batch.gasUsed, batch.gasPrice)
+		}
+		return
+	}
+	if status == BatchConfirmed {
+		return
+	}
+	if m.addressTable != nil {
+		m.addressTable.reset()
+	}
+	if batch.registration {
+		// No transactions depend on the registrations, so there's nothing to
+		// requeue
+		return
+	}
+
+	log.Warn().
+		Str("status", status.String()).
+		Int("txcount", len(batch.txes)).
+		Msg("requeuing transactions from batch")
+	pendingTxes := m.pendingBatch.getAppliedTxes()
+	removedLogs := append(append([]*types.Log{}, batch.logs...), resultLogs(m.pendingBatch.getAppliedResults())...)
+	m.pendingBatch = m.pendingBatch.newFromExisting()
+	m.pendingBatch.resetSnap(m.pendingSentBatches)
+	m.pendingBatch.removePendingLogs(removedLogs)
+	for _, tx := range batch.txes {
+		if err := m.requeueTransaction(tx); err != nil {
+			log.Warn().
+				Err(err).
+				Str("tx", tx.Hash().Hex()).
+				Msg("dropped transaction from failed batch")
+		}
+	}
+	for _, tx := range pendingTxes {
+		if err := m.requeueTransaction(tx); err != nil {
+			log.Warn().
+				Err(err).
+				Str("tx", tx.Hash().Hex()).
+				Msg("dropped transaction from pending batch")
+		}
+	}
+}
+
+func (m *Batcher) requeueTransaction(tx *types.Transaction) error {
+	sender, err := types.Sender(m.signer, tx)
+	if err != nil {
+		return err
+	}
+	if err := m.pendingBatch.checkValidForQueue(tx); err != nil {
+		return err
+	}
+	_, err = m.queuedTxes.addTransaction(tx, sender)
+	return err
+}
+
+// resultLogs returns the logs emitted by results, as they were sent to pending
+// log subscribers
+func resultLogs(results []*evm.TxResult) []*types.Log {
+	var logs []*types.Log
+	for _, res := range results {
+		logs = append(logs, res.EthLogs(common.Hash{})...)
+	}
+	return logs
+}
+
+func findReceipt(ctx context.Context, receiptFetcher ethutils.ReceiptFetcher, txHashes []common.Hash) *types.Receipt {
+	for _, txHash := range txHashes {
+		receipt, err := receiptFetcher.TransactionReceipt(ctx, txHash.ToEthHash())
+		if err == nil && receipt != nil {
+			return receipt
+		}
+	}
+	return nil
+}
@@ -20,11 +20,15 @@ import (
 	"context"
 	"flag"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpc"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
 	"log"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	utils2 "github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/utils"
@@ -51,7 +55,103 @@ func main() {
 		"maxBatchTime=NumSeconds",
 	)
 
-	forwardTxURL := fs.String("forward-url", "", "url of another aggregator to send transactions through")
+	forwardTxURL := fs.String("forward-url", "", "comma separated urls of other aggregators to send transactions through")
+	forwardBroadcast := fs.Bool(
+		"forward-broadcast",
+		false,
+		"send transactions to every forwarding url instead of only the healthiest one",
+	)
+
+	priceBump := fs.Uint64(
+		"price-bump",
+		batcher.DefaultQueueConfig().PriceBump,
+		"minimum gas price increase percentage required to replace a queued transaction",
+	)
+	maxAccountQueue := fs.Int(
+		"max-account-queue",
+		batcher.DefaultQueueConfig().MaxPerAccount,
+		"maximum number of queued transactions per sender (0 for no limit)",
+	)
+	maxQueue := fs.Int(
+		"max-queue",
+		batcher.DefaultQueueConfig().MaxQueued,
+		"maximum number of queued transactions across all senders (0 for no limit)",
+	)
+	queueLifetime := fs.Int64(
+		"queue-lifetime",
+		int64(batcher.DefaultQueueConfig().Lifetime/time.Second),
+		"queue-lifetime=NumSeconds after which queued transactions are dropped (0 to keep forever)",
+	)
+	batchGasBump := fs.Uint64(
+		"batch-gas-bump",
+		batcher.DefaultSubmissionConfig().GasPriceBump,
+		"percentage to increase the L1 gas price by when resubmitting a batch",
+	)
+	batchMaxAttempts := fs.Int(
+		"batch-max-attempts",
+		batcher.DefaultSubmissionConfig().MaxAttempts,
+		"number of times to submit a batch before requeuing its transactions",
+	)
+	batchReceiptTimeout := fs.Int64(
+		"batch-receipt-timeout",
+		int64(batcher.DefaultSubmissionConfig().ReceiptTimeout/time.Second),
+		"batch-receipt-timeout=NumSeconds to wait for a batch to be mined before resubmitting it",
+	)
+	ordering := fs.String(
+		"ordering",
+		"random",
+		"order in which senders' transactions are added to batches (random, fifo or gasprice)",
+	)
+	orderingSeed := fs.Int64(
+		"ordering-seed",
+		0,
+		"seed for random ordering to make batches reproducible (0 for non-reproducible)",
+	)
+	addressTable := fs.Bool(
+		"address-table",
+		false,
+		"replace destinations of batched transactions with their index in the ArbOS address table",
+	)
+	registerThreshold := fs.Int(
+		"address-register-threshold",
+		batcher.DefaultAddressTableConfig().RegisterThreshold,
+		"number of batched transactions to an address after which it is registered in the address table (0 to disable)",
+	)
+	maxRegistrations := fs.Int(
+		"address-max-registrations",
+		batcher.DefaultAddressTableConfig().MaxRegistrations,
+		"maximum number of addresses registered in a single registration message",
+	)
+	heartbeatInterval := fs.Int64(
+		"heartbeat-interval",
+		0,
+		"heartbeat-interval=NumSeconds the inbox must be idle before a heartbeat message is sent (0 to disable)",
+	)
+	heartbeatBudget := fs.String(
+		"heartbeat-budget",
+		batcher.DefaultHeartbeatConfig().Budget.String(),
+		"maximum wei spent on heartbeat messages per day",
+	)
+	archive := fs.Bool(
+		"archive",
+		false,
+		"rebuild the state at any height from machine checkpoints",
+	)
+	archiveCheckpointInterval := fs.Uint64(
+		"archive-checkpoint-interval",
+		txdb.DefaultArchiveConfig().CheckpointInterval,
+		"archive-checkpoint-interval=NumBlocks between machine checkpoints kept in archive mode",
+	)
+	archiveCacheSize := fs.Int(
+		"archive-cache-size",
+		txdb.DefaultArchiveConfig().CacheSize,
+		"number of rebuilt snapshots kept in memory in archive mode",
+	)
+	indexAddresses := fs.Bool(
+		"index-addresses",
+		false,
+		"index transactions by sender, recipient and created contract for arb_getTransactionsByAddress",
+	)
 
 	//go http.ListenAndServe("localhost:6060", nil)
 
@@ -79,8 +179,11 @@ func main() {
 
 	var batcherMode rpc.BatcherMode
 	if *forwardTxURL != "" {
-		log.Println("Aggregator starting in forwarder mode sending transactions to", *forwardTxURL)
-		batcherMode = rpc.ForwarderBatcherMode{NodeURL: *forwardTxURL}
+		forwardURLs := strings.Split(*forwardTxURL, ",")
+		log.Println("Aggregator starting in forwarder mode sending transactions to", forwardURLs)
+		forwarderConfig := batcher.DefaultForwarderConfig()
+		forwarderConfig.Broadcast = *forwardBroadcast
+		batcherMode = rpc.ForwarderBatcherMode{NodeURLs: forwardURLs, Config: forwarderConfig}
 	} else {
 		auth, err := utils.GetKeystore(rollupArgs.ValidatorFolder, walletArgs, fs)
 		if err != nil {
@@ -98,13 +201,57 @@ func main() {
 			log.Fatal(err)
 		}
 
+		queueConfig := batcher.DefaultQueueConfig()
+		queueConfig.PriceBump = *priceBump
+		queueConfig.MaxPerAccount = *maxAccountQueue
+		queueConfig.MaxQueued = *maxQueue
+		queueConfig.Lifetime = time.Duration(*queueLifetime) * time.Second
+		queueConfig.Ordering, err = batcher.ParseOrderingPolicy(*ordering, *orderingSeed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Aggregator ordering transactions using policy", queueConfig.Ordering)
+
+		submissionConfig := batcher.DefaultSubmissionConfig()
+		submissionConfig.GasPriceBump = *batchGasBump
+		submissionConfig.MaxAttempts = *batchMaxAttempts
+		submissionConfig.ReceiptTimeout = time.Duration(*batchReceiptTimeout) * time.Second
+
+		var addressTableConfig *batcher.AddressTableConfig
+		if *addressTable {
+			config := batcher.DefaultAddressTableConfig()
+			config.RegisterThreshold = *registerThreshold
+			config.MaxRegistrations = *maxRegistrations
+			addressTableConfig = &config
+		}
+
+		var heartbeatConfig *batcher.HeartbeatConfig
+		if *heartbeatInterval > 0 {
+			config := batcher.DefaultHeartbeatConfig()
+			config.Interval = time.Duration(*heartbeatInterval) * time.Second
+			budget, ok := new(big.Int).SetString(*heartbeatBudget, 10)
+			if !ok {
+				log.Fatal("invalid heartbeat budget ", *heartbeatBudget)
+			}
+			config.Budget = budget
+			heartbeatConfig = &config
+		}
+
 		if *keepPendingState {
-			batcherMode = rpc.StatefulBatcherMode{Auth: auth}
+			batcherMode = rpc.StatefulBatcherMode{Auth: auth, Queue: queueConfig, Submission: submissionConfig, AddressTable: addressTableConfig, Heartbeat: heartbeatConfig}
 		} else {
-			batcherMode = rpc.StatelessBatcherMode{Auth: auth}
+			batcherMode = rpc.StatelessBatcherMode{Auth: auth, Queue: queueConfig, Submission: submissionConfig, AddressTable: addressTableConfig, Heartbeat: heartbeatConfig}
 		}
 	}
 
+	var archiveConfig *txdb.ArchiveConfig
+	if *archive {
+		config := txdb.DefaultArchiveConfig()
+		config.CheckpointInterval = *archiveCheckpointInterval
+		config.CacheSize = *archiveCacheSize
+		archiveConfig = &config
+	}
+
 	contractFile := filepath.Join(rollupArgs.ValidatorFolder, "contract.mexe")
 	dbPath := filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
 
@@ -119,6 +266,8 @@ func main() {
 		rpcVars,
 		time.Duration(*maxBatchTime)*time.Second,
 		batcherMode,
+		archiveConfig,
+		*indexAddresses,
 	); err != nil {
 		log.Fatal(err)
 	}
@@ -8,6 +8,7 @@ require (
 	github.com/ethereum/go-ethereum v1.9.24
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
+	github.com/hashicorp/golang-lru v0.5.4
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/mattn/go-tty v0.0.3 // indirect
 	github.com/offchainlabs/arbitrum/packages/arb-avm-cpp v0.7.3
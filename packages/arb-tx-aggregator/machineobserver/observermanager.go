@@ -18,9 +18,11 @@ package machineobserver
 
 import (
 	"context"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	errors2 "github.com/pkg/errors"
 	"log"
 	"math/big"
+	"path/filepath"
 	"time"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
@@ -121,13 +123,27 @@ func RunObserver(
 	clnt arbbridge.ArbClient,
 	executablePath string,
 	dbPath string,
+	archiveConfig *txdb.ArchiveConfig,
+	indexAddresses bool,
 ) (*txdb.TxDB, error) {
-	cp, err := checkpointing.NewIndexedCheckpointer(
-		rollupAddr,
-		dbPath,
-		big.NewInt(defaultMaxReorgDepth),
-		false,
-	)
+	var cp *checkpointing.IndexedCheckpointer
+	var err error
+	if archiveConfig != nil {
+		cp, err = checkpointing.NewArchiveIndexedCheckpointer(
+			rollupAddr,
+			dbPath,
+			big.NewInt(defaultMaxReorgDepth),
+			new(big.Int).SetUint64(archiveConfig.CheckpointInterval),
+			false,
+		)
+	} else {
+		cp, err = checkpointing.NewIndexedCheckpointer(
+			rollupAddr,
+			dbPath,
+			big.NewInt(defaultMaxReorgDepth),
+			false,
+		)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +164,12 @@ func RunObserver(
 		return nil, err
 	}
 
-	db := txdb.New(clnt, cp, cp.GetAggregatorStore(), rollupAddr)
+	indexDB, err := rawdb.NewLevelDBDatabase(filepath.Join(filepath.Dir(dbPath), "index_db"), 16, 16, "")
+	if err != nil {
+		return nil, err
+	}
+
+	db := txdb.New(clnt, cp, cp.GetAggregatorStore(), indexDB, rollupAddr, archiveConfig, indexAddresses)
 
 	if err := ensureInitialized(ctx, cp, db, clnt, rollupAddr); err != nil {
 		return nil, err
@@ -190,6 +211,13 @@ func RunObserver(
 						return err
 					}
 					log.Println("Getting events between", start, "and", fetchEnd, "with", new(big.Int).Sub(currentOnChain.Height.AsInt(), start), "blocks remaining")
+					rollupEvents, err := rollupWatcher.GetAllEvents(runCtx, start, fetchEnd)
+					if err != nil {
+						return errors2.Wrap(err, "Manager hit error getting rollup events in fast catchup")
+					}
+					if err := db.AddRollupEvents(rollupEvents); err != nil {
+						return errors2.Wrap(err, "error adding rollup events to db")
+					}
 					inboxDeliveredEvents, err := inboxWatcher.GetDeliveredEvents(runCtx, start, fetchEnd)
 					if err != nil {
 						return errors2.Wrap(err, "Manager hit error doing fast catchup")
@@ -217,6 +245,14 @@ func RunObserver(
 					blockId := maybeBlockId.BlockId
 					timestamp := maybeBlockId.Timestamp
 
+					rollupEvents, err := rollupWatcher.GetEvents(runCtx, blockId, timestamp)
+					if err != nil {
+						return errors2.Wrapf(err, "manager hit error getting rollup events with block %v", blockId)
+					}
+					if err := db.AddRollupEvents(rollupEvents); err != nil {
+						return errors2.Wrap(err, "error adding rollup events to db")
+					}
+
 					inboxEvents, err := inboxWatcher.GetDeliveredEventsInBlock(runCtx, blockId, timestamp)
 					if err != nil {
 						return errors2.Wrapf(err, "manager hit error getting inbox events with block %v", blockId)
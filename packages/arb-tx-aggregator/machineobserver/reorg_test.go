@@ -140,6 +140,8 @@ func TestReorg(t *testing.T) {
 		arbbridge.NewStressTestClient(ethbridge.NewEthClient(l1Client), time.Second),
 		arbos.Path(),
 		dbPath,
+		nil,
+		false,
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -18,14 +18,16 @@ package rpc
 
 import (
 	"context"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"path/filepath"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/machineobserver"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
 	utils2 "github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/utils"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/web3"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
@@ -38,23 +40,50 @@ type BatcherMode interface {
 }
 
 type ForwarderBatcherMode struct {
-	NodeURL string
+	NodeURLs []string
+	Config   batcher.ForwarderConfig
 }
 
 func (b ForwarderBatcherMode) isBatcherMode() {}
 
 type StatefulBatcherMode struct {
-	Auth *bind.TransactOpts
+	Auth         *bind.TransactOpts
+	Queue        batcher.QueueConfig
+	Submission   batcher.SubmissionConfig
+	AddressTable *batcher.AddressTableConfig
+	Heartbeat    *batcher.HeartbeatConfig
 }
 
 func (b StatefulBatcherMode) isBatcherMode() {}
 
 type StatelessBatcherMode struct {
-	Auth *bind.TransactOpts
+	Auth         *bind.TransactOpts
+	Queue        batcher.QueueConfig
+	Submission   batcher.SubmissionConfig
+	AddressTable *batcher.AddressTableConfig
+	Heartbeat    *batcher.HeartbeatConfig
 }
 
 func (b StatelessBatcherMode) isBatcherMode() {}
 
+// newAddressTable returns nil if address table compression is disabled
+func newAddressTable(auth *bind.TransactOpts, config *batcher.AddressTableConfig, db *txdb.TxDB) *batcher.AddressTable {
+	if config == nil {
+		return nil
+	}
+	tableConfig := *config
+	tableConfig.Registrar = common.NewAddressFromEth(auth.From)
+	return batcher.NewAddressTable(tableConfig, db)
+}
+
+// newHeartbeat returns nil if heartbeats are disabled
+func newHeartbeat(config *batcher.HeartbeatConfig, db *txdb.TxDB) *batcher.Heartbeat {
+	if config == nil {
+		return nil
+	}
+	return batcher.NewHeartbeat(*config, db)
+}
+
 func LaunchAggregator(
 	ctx context.Context,
 	client ethutils.EthClient,
@@ -66,9 +95,11 @@ func LaunchAggregator(
 	flags utils2.RPCFlags,
 	maxBatchTime time.Duration,
 	batcherMode BatcherMode,
+	archiveConfig *txdb.ArchiveConfig,
+	indexAddresses bool,
 ) error {
 	arbClient := ethbridge.NewEthClient(client)
-	db, err := machineobserver.RunObserver(ctx, rollupAddress, arbClient, executable, dbPath)
+	db, err := machineobserver.RunObserver(ctx, rollupAddress, arbClient, executable, dbPath, archiveConfig, indexAddresses)
 	if err != nil {
 		return err
 	}
@@ -84,25 +115,34 @@ func LaunchAggregator(
 	var batch batcher.TransactionBatcher
 	switch batcherMode := batcherMode.(type) {
 	case ForwarderBatcherMode:
-		forwardClient, err := ethclient.DialContext(ctx, batcherMode.NodeURL)
+		batch, err = batcher.NewForwarder(ctx, batcherMode.NodeURLs, batcherMode.Config)
 		if err != nil {
 			return err
 		}
-		batch = batcher.NewForwarder(forwardClient)
 	case StatelessBatcherMode:
 		authClient := ethbridge.NewEthAuthClient(client, batcherMode.Auth)
 		globalInbox, err := authClient.NewGlobalInbox(inboxAddress, rollupAddress)
 		if err != nil {
 			return err
 		}
-		batch = batcher.NewStatelessBatcher(ctx, rollupAddress, client, globalInbox, maxBatchTime)
+		journalDB, err := rawdb.NewLevelDBDatabase(filepath.Join(filepath.Dir(dbPath), "tx_journal"), 16, 16, "")
+		if err != nil {
+			return err
+		}
+		journal := batcher.NewJournal(journalDB, db)
+		batch = batcher.NewStatelessBatcher(ctx, rollupAddress, client, globalInbox, maxBatchTime, batcherMode.Queue, batcherMode.Submission, journal, newAddressTable(batcherMode.Auth, batcherMode.AddressTable, db), newHeartbeat(batcherMode.Heartbeat, db))
 	case StatefulBatcherMode:
 		authClient := ethbridge.NewEthAuthClient(client, batcherMode.Auth)
 		globalInbox, err := authClient.NewGlobalInbox(inboxAddress, rollupAddress)
 		if err != nil {
 			return err
 		}
-		batch = batcher.NewStatefulBatcher(ctx, db, rollupAddress, client, globalInbox, maxBatchTime)
+		journalDB, err := rawdb.NewLevelDBDatabase(filepath.Join(filepath.Dir(dbPath), "tx_journal"), 16, 16, "")
+		if err != nil {
+			return err
+		}
+		journal := batcher.NewJournal(journalDB, db)
+		batch = batcher.NewStatefulBatcher(ctx, db, rollupAddress, client, globalInbox, maxBatchTime, batcherMode.Queue, batcherMode.Submission, journal, newAddressTable(batcherMode.Auth, batcherMode.AddressTable, db), newHeartbeat(batcherMode.Heartbeat, db))
 	}
 
 	srv := aggregator.NewServer(batch, rollupAddress, db)
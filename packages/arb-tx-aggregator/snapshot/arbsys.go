@@ -158,6 +158,47 @@ func ParseERC721WithdrawalEvent(log evm.Log) (*arboscontracts.ArbSysERC721Withdr
 	return event, nil
 }
 
+// ParseWithdrawal returns the message.Eth, message.ERC20 or message.ERC721
+// sent to L1 by an ArbSys withdrawal event, or nil if the log isn't one
+func ParseWithdrawal(log evm.Log) message.Message {
+	if log.Address.ToEthAddress() != arbos.ARB_SYS_ADDRESS || len(log.Topics) == 0 {
+		return nil
+	}
+	switch log.Topics[0].ToEthHash() {
+	case ethWithdrawal:
+		ev, err := ParseEthWithdrawalEvent(log)
+		if err != nil {
+			return nil
+		}
+		return message.Eth{
+			Dest:  common.NewAddressFromEth(ev.DestAddr),
+			Value: ev.Amount,
+		}
+	case erc20Withdrawal:
+		ev, err := ParseERC20WithdrawalEvent(log)
+		if err != nil {
+			return nil
+		}
+		return message.ERC20{
+			Token: common.NewAddressFromEth(ev.TokenAddr),
+			Dest:  common.NewAddressFromEth(ev.DestAddr),
+			Value: ev.Amount,
+		}
+	case erc721Withdrawal:
+		ev, err := ParseERC721WithdrawalEvent(log)
+		if err != nil {
+			return nil
+		}
+		return message.ERC721{
+			Token: common.NewAddressFromEth(ev.TokenAddr),
+			Dest:  common.NewAddressFromEth(ev.DestAddr),
+			ID:    ev.Id,
+		}
+	default:
+		return nil
+	}
+}
+
 func StorageAtData(address common.Address, index *big.Int) []byte {
 	return makeFuncData(getStorageAtABI, address, index)
 }
@@ -182,6 +223,18 @@ func AddressTableLookupData(address common.Address) []byte {
 	return makeFuncData(addressTableLookupABI, address)
 }
 
+func parseAddressTableLookupResult(res *evm.TxResult) (*big.Int, error) {
+	vals, err := addressTableLookupABI.Outputs.UnpackValues(res.ReturnData)
+	if err != nil {
+		return nil, err
+	}
+	val, ok := vals[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("unexpected tx result")
+	}
+	return val, nil
+}
+
 func AddressTableAddressExistsData(address common.Address) []byte {
 	return makeFuncData(addressTableAddressExistsABI, address)
 }
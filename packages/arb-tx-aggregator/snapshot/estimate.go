@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// EstimateGas binary searches for the lowest gas limit at which msg succeeds,
+// bounded by msg.MaxGas and, if the sender is paying for gas, by the amount
+// of gas the sender can afford. If msg fails even at the cap, the failure is
+// returned as an *ExecutionError
+func (s *Snapshot) EstimateGas(msg message.Call, sender common.Address) (uint64, error) {
+	gasCap := msg.MaxGas.Uint64()
+	if msg.GasPriceBid.Sign() > 0 {
+		balance, err := s.GetBalance(sender)
+		if err != nil {
+			return 0, fmt.Errorf("error getting balance: %v", err)
+		}
+		available := new(big.Int).Sub(balance, msg.Payment)
+		if available.Sign() < 0 {
+			return 0, errors.New("insufficient funds for transfer")
+		}
+		allowance := new(big.Int).Div(available, msg.GasPriceBid)
+		if allowance.IsUint64() && allowance.Uint64() < gasCap {
+			gasCap = allowance.Uint64()
+		}
+	}
+
+	run := func(gas uint64) (*evm.TxResult, error) {
+		msg.MaxGas = new(big.Int).SetUint64(gas)
+		return s.Call(msg, sender)
+	}
+
+	res, err := run(gasCap)
+	if err != nil {
+		return 0, err
+	}
+	if res.ResultCode != evm.ReturnCode {
+		return 0, NewExecutionError(res)
+	}
+
+	// Execution can never use more gas than it was given, so the gas used at
+	// the cap is a lower bound on the required limit
+	lo := res.GasUsed.Uint64()
+	if lo > 0 {
+		lo--
+	}
+	hi := gasCap
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		res, err := run(mid)
+		if err != nil {
+			return 0, err
+		}
+		if res.ResultCode == evm.ReturnCode {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+// executionErrorCode is the JSON-RPC error code geth uses for calls which
+// fail during execution
+const executionErrorCode = 3
+
+// ExecutionError describes why a call didn't succeed. It's reported over
+// JSON-RPC the same way as geth's execution errors, with the Arbitrum result
+// code added to the error data
+type ExecutionError struct {
+	ResultCode evm.ResultType
+	ReturnData []byte
+
+	// Reason is the decoded Error(string) revert reason, or nil if the call
+	// didn't revert with one
+	Reason *string
+}
+
+// ExecutionErrorData is the data field of an ExecutionError's JSON-RPC error
+type ExecutionErrorData struct {
+	ResultCode string        `json:"resultCode"`
+	ReturnData hexutil.Bytes `json:"returnData"`
+}
+
+func NewExecutionError(res *evm.TxResult) *ExecutionError {
+	var reason *string
+	if res.ResultCode == evm.RevertCode {
+		if unpacked, err := abi.UnpackRevert(res.ReturnData); err == nil {
+			reason = &unpacked
+		}
+	}
+	return &ExecutionError{
+		ResultCode: res.ResultCode,
+		ReturnData: res.ReturnData,
+		Reason:     reason,
+	}
+}
+
+func (e *ExecutionError) Error() string {
+	if e.ResultCode != evm.RevertCode {
+		return fmt.Sprintf("execution failed with result %v", e.ResultCode)
+	}
+	if e.Reason != nil {
+		return fmt.Sprintf("execution reverted: %v", *e.Reason)
+	}
+	return "execution reverted"
+}
+
+func (e *ExecutionError) ErrorCode() int {
+	return executionErrorCode
+}
+
+func (e *ExecutionError) ErrorData() interface{} {
+	return ExecutionErrorData{
+		ResultCode: e.ResultCode.String(),
+		ReturnData: e.ReturnData,
+	}
+}
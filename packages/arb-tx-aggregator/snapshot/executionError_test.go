@@ -0,0 +1,112 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+func TestNewExecutionError(t *testing.T) {
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := abi.Arguments{{Type: stringType}}.Pack("not enough funds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Error(string) selector followed by the ABI encoded reason
+	revertData := append(hexutil.MustDecode("0x08c379a0"), packed...)
+
+	tests := []struct {
+		name       string
+		resultCode evm.ResultType
+		returnData []byte
+		reason     *string
+		message    string
+	}{
+		{
+			name:       "RevertReason",
+			resultCode: evm.RevertCode,
+			returnData: revertData,
+			reason:     stringPtr("not enough funds"),
+			message:    "execution reverted: not enough funds",
+		},
+		{
+			name:       "PlainRevert",
+			resultCode: evm.RevertCode,
+			returnData: nil,
+			message:    "execution reverted",
+		},
+		{
+			name:       "CustomRevertData",
+			resultCode: evm.RevertCode,
+			returnData: []byte{1, 2, 3, 4},
+			message:    "execution reverted",
+		},
+		{
+			name:       "Congestion",
+			resultCode: evm.CongestionCode,
+			returnData: revertData,
+			message:    "execution failed with result Congestion",
+		},
+		{
+			name:       "BadSequence",
+			resultCode: evm.BadSequenceCode,
+			returnData: nil,
+			message:    "execution failed with result BadSequence",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			execErr := NewExecutionError(&evm.TxResult{
+				ResultCode: test.resultCode,
+				ReturnData: test.returnData,
+			})
+			if (execErr.Reason == nil) != (test.reason == nil) ||
+				(test.reason != nil && *execErr.Reason != *test.reason) {
+				t.Error("wrong reason", execErr.Reason)
+			}
+			if execErr.Error() != test.message {
+				t.Error("wrong message", execErr.Error())
+			}
+			if execErr.ErrorCode() != 3 {
+				t.Error("wrong error code", execErr.ErrorCode())
+			}
+			data, ok := execErr.ErrorData().(ExecutionErrorData)
+			if !ok {
+				t.Fatal("wrong error data type")
+			}
+			if data.ResultCode != test.resultCode.String() {
+				t.Error("wrong result code", data.ResultCode)
+			}
+			if !bytes.Equal(data.ReturnData, test.returnData) {
+				t.Error("wrong return data", data.ReturnData)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// maxNonceOverrideIncrease limits how many transactions will be executed to
+// raise the nonce of an account for a nonce override
+const maxNonceOverrideIncrease = 1000
+
+var (
+	// overrideSink receives any funds removed from an account by a balance
+	// override
+	overrideSink = common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+
+	overrideGas = big.NewInt(1000000000)
+)
+
+// ErrUnsupportedOverride is returned when an override would modify the code
+// or storage of an existing contract. ArbOS provides no way to modify them,
+// so only accounts without code can have their code and storage overridden
+var ErrUnsupportedOverride = errors.New("can't override code or storage of an existing contract")
+
+// AccountOverride describes modifications to the state of an account that
+// should be applied before executing a call. Nil fields are left unmodified
+type AccountOverride struct {
+	Balance *big.Int
+	Nonce   *uint64
+	Code    []byte
+
+	// State replaces the entire storage of the account
+	State map[common.Hash]common.Hash
+
+	// StateDiff replaces the given storage slots, leaving the others
+	// unmodified. It can't be combined with State
+	StateDiff map[common.Hash]common.Hash
+}
+
+// ApplyOverride modifies the state of account by executing messages sent from
+// it. Since ArbOS provides no way to directly modify account state, the code
+// and storage of an account can only be overridden if it has no code and the
+// nonce of an account can only be increased.
+//
+// ApplyOverride can only be called if the snapshot is uniquely owned
+func (s *Snapshot) ApplyOverride(account common.Address, override AccountOverride) error {
+	if override.State != nil && override.StateDiff != nil {
+		return errors.New("can't override both state and stateDiff")
+	}
+	if override.Code != nil || override.State != nil || override.StateDiff != nil {
+		if err := s.overrideCode(account, override); err != nil {
+			return err
+		}
+	}
+	if override.Balance != nil {
+		if err := s.overrideBalance(account, override.Balance); err != nil {
+			return err
+		}
+	}
+	if override.Nonce != nil {
+		if err := s.overrideNonce(account, *override.Nonce); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) overrideCode(account common.Address, override AccountOverride) error {
+	existingCode, err := s.GetCode(account)
+	if err != nil {
+		return err
+	}
+	if len(existingCode) > 0 {
+		// Setting the code to what it already is is the only override that
+		// doesn't modify the contract. Even an empty State would clear its
+		// storage
+		if override.State == nil && len(override.StateDiff) == 0 && bytes.Equal(existingCode, override.Code) {
+			return nil
+		}
+		return ErrUnsupportedOverride
+	}
+
+	// An account without code has no storage, so replacing its storage and
+	// modifying it are equivalent
+	storage := override.State
+	if storage == nil {
+		storage = override.StateDiff
+	}
+	if len(override.Code) == 0 && len(storage) == 0 {
+		return nil
+	}
+	// Deploying a buddy contract creates a contract at the address of the
+	// sender, so we deploy a constructor that sets the requested storage
+	// and returns the requested code
+	return s.applyMessage(message.BuddyDeployment{
+		MaxGas:      overrideGas,
+		GasPriceBid: big.NewInt(0),
+		Payment:     big.NewInt(0),
+		Data:        overrideConstructor(override.Code, storage),
+	}, account)
+}
+
+func (s *Snapshot) overrideBalance(account common.Address, balance *big.Int) error {
+	current, err := s.GetBalance(account)
+	if err != nil {
+		return err
+	}
+	switch current.Cmp(balance) {
+	case -1:
+		return s.applyMessage(message.Eth{
+			Dest:  account,
+			Value: new(big.Int).Sub(balance, current),
+		}, account)
+	case 1:
+		nonce, err := s.GetTransactionCount(account)
+		if err != nil {
+			return err
+		}
+		return s.applyMessage(message.NewSafeL2Message(message.Transaction{
+			MaxGas:      overrideGas,
+			GasPriceBid: big.NewInt(0),
+			SequenceNum: nonce,
+			DestAddress: overrideSink,
+			Payment:     new(big.Int).Sub(current, balance),
+			Data:        nil,
+		}), account)
+	default:
+		return nil
+	}
+}
+
+func (s *Snapshot) overrideNonce(account common.Address, nonce uint64) error {
+	currentBig, err := s.GetTransactionCount(account)
+	if err != nil {
+		return err
+	}
+	current := currentBig.Uint64()
+	if nonce < current {
+		return fmt.Errorf("can't decrease nonce of %v from %v to %v", account, current, nonce)
+	}
+	if nonce-current > maxNonceOverrideIncrease {
+		return fmt.Errorf("can't increase nonce by more than %v", maxNonceOverrideIncrease)
+	}
+	for seq := current; seq < nonce; seq++ {
+		if err := s.applyMessage(message.NewSafeL2Message(message.Transaction{
+			MaxGas:      overrideGas,
+			GasPriceBid: big.NewInt(0),
+			SequenceNum: new(big.Int).SetUint64(seq),
+			DestAddress: overrideSink,
+			Payment:     big.NewInt(0),
+			Data:        nil,
+		}), account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMessage executes msg and updates the snapshot if it succeeded. If an
+// error is returned, s is unmodified
+func (s *Snapshot) applyMessage(msg message.Message, sender common.Address) error {
+	mach := s.mach.Clone()
+	inboxMsg := message.NewInboxMessage(msg, sender, s.nextInboxSeqNum, s.time)
+	res, err := runMessage(mach, inboxMsg)
+	if err != nil {
+		return err
+	}
+	if res.ResultCode != evm.ReturnCode {
+		return fmt.Errorf("failed to apply override with result %v", res.ResultCode)
+	}
+	s.mach = mach
+	s.nextInboxSeqNum = new(big.Int).Add(s.nextInboxSeqNum, big.NewInt(1))
+	return nil
+}
+
+// overrideConstructor generates EVM init code which writes the given storage
+// and then returns code as the contract's runtime code
+func overrideConstructor(code []byte, storage map[common.Hash]common.Hash) []byte {
+	var initCode []byte
+	for key, val := range storage {
+		// PUSH32 val PUSH32 key SSTORE
+		initCode = append(initCode, 0x7f)
+		initCode = append(initCode, val[:]...)
+		initCode = append(initCode, 0x7f)
+		initCode = append(initCode, key[:]...)
+		initCode = append(initCode, 0x55)
+	}
+
+	// PUSH4 len DUP1 PUSH4 offset PUSH1 0 CODECOPY PUSH1 0 RETURN
+	const copyCodeLength = 17
+	var codeLength, codeOffset [4]byte
+	binary.BigEndian.PutUint32(codeLength[:], uint32(len(code)))
+	binary.BigEndian.PutUint32(codeOffset[:], uint32(len(initCode)+copyCodeLength))
+	initCode = append(initCode, 0x63)
+	initCode = append(initCode, codeLength[:]...)
+	initCode = append(initCode, 0x80, 0x63)
+	initCode = append(initCode, codeOffset[:]...)
+	initCode = append(initCode, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3)
+	return append(initCode, code...)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+)
+
+// ReplayTransaction re-executes the transaction that produced res. s must
+// hold the state at the start of the transaction's block and blockResults
+// must hold the results of the block in order, at least up to res. The
+// transactions that came earlier in the block are applied first, including
+// ones that failed since they still affect the state. Each message is
+// executed with the inbox sequence number of the L1 message that delivered
+// it so that every transaction of a batch shares the batch's sequence number
+func (s *Snapshot) ReplayTransaction(res *evm.TxResult, blockResults []*evm.TxResult) (*evm.TxResult, error) {
+	snap := s.Clone()
+	snap.AdvanceTime(res.IncomingRequest.ChainTime)
+	for _, prev := range blockResults {
+		if prev.TxIndex.Cmp(res.TxIndex) >= 0 {
+			break
+		}
+		msg, err := message.NestedMessage(prev.IncomingRequest.Data, prev.IncomingRequest.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode earlier transaction %v: %v", prev.IncomingRequest.MessageID, err)
+		}
+		snap.setNextInboxSeqNum(prev.IncomingRequest.Provenance.L1SeqNum)
+		// An error here means the earlier state couldn't be reproduced
+		if _, err := snap.AddMessage(msg, prev.IncomingRequest.Sender, prev.IncomingRequest.MessageID); err != nil {
+			return nil, fmt.Errorf("failed to replay earlier transaction %v: %v", prev.IncomingRequest.MessageID, err)
+		}
+	}
+
+	msg, err := message.NestedMessage(res.IncomingRequest.Data, res.IncomingRequest.Kind)
+	if err != nil {
+		return nil, err
+	}
+	snap.setNextInboxSeqNum(res.IncomingRequest.Provenance.L1SeqNum)
+	return snap.TryTx(msg, res.IncomingRequest.Sender, res.IncomingRequest.MessageID)
+}
+
+// setNextInboxSeqNum can only be called if the snapshot is uniquely owned.
+// The sequence number is left unchanged if seqNum is nil
+func (s *Snapshot) setNextInboxSeqNum(seqNum *big.Int) {
+	if seqNum == nil {
+		return
+	}
+	s.nextInboxSeqNum = new(big.Int).Set(seqNum)
+}
@@ -80,6 +80,12 @@ func (s *Snapshot) Height() *common.TimeBlocks {
 	return s.time.BlockNum
 }
 
+// NextInboxSeqNum is the sequence number the next inbox message processed
+// after this snapshot will have
+func (s *Snapshot) NextInboxSeqNum() *big.Int {
+	return new(big.Int).Set(s.nextInboxSeqNum)
+}
+
 func (s *Snapshot) Call(msg message.Call, sender common.Address) (*evm.TxResult, error) {
 	targetHash := hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(s.nextInboxSeqNum))
 	return s.TryTx(message.NewSafeL2Message(msg), sender, targetHash)
@@ -107,7 +113,7 @@ func checkValidResult(res *evm.TxResult) error {
 	if res.ResultCode == evm.ReturnCode {
 		return nil
 	}
-	return fmt.Errorf("error processing call %v", res.ResultCode)
+	return NewExecutionError(res)
 }
 
 func (s *Snapshot) GetBalance(account common.Address) (*big.Int, error) {
@@ -154,7 +160,38 @@ func (s *Snapshot) GetStorageAt(account common.Address, index *big.Int) (*big.In
 	return parseGetStorageAtResult(res)
 }
 
+// AddressTableIndex returns the index of account in the ArbOS address table
+// or nil if it hasn't been registered
+func (s *Snapshot) AddressTableIndex(account common.Address) (*big.Int, error) {
+	res, err := s.BasicCall(AddressTableLookupData(account), common.NewAddressFromEth(arbos.ARB_SYS_ADDRESS))
+	if err != nil {
+		return nil, err
+	}
+	if res.ResultCode == evm.RevertCode {
+		// Looking up an unregistered address reverts
+		return nil, nil
+	}
+	if err := checkValidResult(res); err != nil {
+		return nil, err
+	}
+	return parseAddressTableLookupResult(res)
+}
+
 func runTx(mach machine.Machine, msg inbox.InboxMessage, targetHash common.Hash) (*evm.TxResult, error) {
+	res, err := runMessage(mach, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.IncomingRequest.MessageID != targetHash {
+		return nil, fmt.Errorf("call got unexpected result %v instead of %v", res.IncomingRequest.MessageID, targetHash)
+	}
+
+	return res, nil
+}
+
+// runMessage executes msg on mach and returns the last result it produced
+func runMessage(mach machine.Machine, msg inbox.InboxMessage) (*evm.TxResult, error) {
 	assertion, steps := mach.ExecuteAssertion(100000000, []inbox.InboxMessage{msg}, 0)
 
 	// If the machine wasn't able to run and it reports that it is currently
@@ -169,14 +206,5 @@ func runTx(mach machine.Machine, msg inbox.InboxMessage, targetHash common.Hash)
 		return nil, errors.New("no logs produced by tx")
 	}
 
-	res, err := evm.NewTxResultFromValue(avmLogs[len(avmLogs)-1])
-	if err != nil {
-		return nil, err
-	}
-
-	if res.IncomingRequest.MessageID != targetHash {
-		return nil, fmt.Errorf("call got unexpected result %v instead of %v", res.IncomingRequest.MessageID, targetHash)
-	}
-
-	return res, nil
+	return evm.NewTxResultFromValue(avmLogs[len(avmLogs)-1])
 }
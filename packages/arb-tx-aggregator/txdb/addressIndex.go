@@ -0,0 +1,170 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+var (
+	addressTxPrefix  = []byte("addressTx")
+	addressLogPrefix = []byte("addressLog")
+)
+
+var errAddressIndexDisabled = errors.New("address index is not enabled")
+
+// AddressTx is an entry in an account's transaction history
+type AddressTx struct {
+	// LogIndex is the index of the AVM log containing the transaction's
+	// result
+	LogIndex  uint64
+	RequestId common.Hash
+}
+
+// addressIndex maps accounts to the requests which they sent, which were sent
+// to them, or which created them.
+//
+// Entries are keyed by account and then by decreasing log index so that the
+// most recent transactions come first. Each entry has a matching key ordered
+// by log index so that the entries for logs removed by a reorg can be deleted
+type addressIndex struct {
+	db ethdb.Database
+}
+
+func newAddressIndex(db ethdb.Database) *addressIndex {
+	return &addressIndex{db: db}
+}
+
+func addressTxKey(account common.Address, logIndex uint64) []byte {
+	key := append(append([]byte{}, addressTxPrefix...), account.Bytes()...)
+	return append(key, encodeUint64(math.MaxUint64-logIndex)...)
+}
+
+func addressLogKey(logIndex uint64, account common.Address) []byte {
+	key := append(append([]byte{}, addressLogPrefix...), encodeUint64(logIndex)...)
+	return append(key, account.Bytes()...)
+}
+
+// txAddresses returns the accounts involved in a request without duplicates
+func txAddresses(res *evm.TxResult) []common.Address {
+	accounts := []common.Address{res.IncomingRequest.Sender}
+	add := func(account common.Address) {
+		if account == (common.Address{}) {
+			return
+		}
+		for _, existing := range accounts {
+			if existing == account {
+				return
+			}
+		}
+		accounts = append(accounts, account)
+	}
+
+	if deposit := NewDeposit(res); deposit != nil {
+		add(deposit.Dest())
+	}
+	if tx, err := evm.GetTransaction(res); err == nil {
+		if tx.Tx.To() != nil {
+			add(common.NewAddressFromEth(*tx.Tx.To()))
+		}
+		add(common.NewAddressFromEth(res.ToEthReceipt(common.Hash{}).ContractAddress))
+	}
+	return accounts
+}
+
+// addResults indexes a block's results. startLog is the log index of the
+// first result. Results rejected for having the wrong sequence number are
+// skipped since they may be resubmissions of requests that were already
+// indexed
+func (idx *addressIndex) addResults(startLog uint64, results []*evm.TxResult) error {
+	batch := idx.db.NewBatch()
+	for i, res := range results {
+		if res.ResultCode == evm.BadSequenceCode {
+			continue
+		}
+		logIndex := startLog + uint64(i)
+		for _, account := range txAddresses(res) {
+			if err := batch.Put(addressTxKey(account, logIndex), res.IncomingRequest.MessageID.Bytes()); err != nil {
+				return err
+			}
+			if err := batch.Put(addressLogKey(logIndex, account), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Write()
+}
+
+// rollback deletes the entries for logs at or after logCount
+func (idx *addressIndex) rollback(logCount uint64) error {
+	it := idx.db.NewIterator(addressLogPrefix, encodeUint64(logCount))
+	defer it.Release()
+	batch := idx.db.NewBatch()
+	for it.Next() {
+		key := it.Key()[len(addressLogPrefix):]
+		logIndex := binary.BigEndian.Uint64(key[:8])
+		var account common.Address
+		copy(account[:], key[8:])
+		if err := batch.Delete(addressTxKey(account, logIndex)); err != nil {
+			return err
+		}
+		if err := batch.Delete(append([]byte{}, it.Key()...)); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// transactions returns up to limit of the account's transactions with log
+// indexes below before, most recent first
+func (idx *addressIndex) transactions(account common.Address, before uint64, limit int) ([]AddressTx, error) {
+	txs := make([]AddressTx, 0)
+	if before == 0 {
+		return txs, nil
+	}
+	prefix := append(append([]byte{}, addressTxPrefix...), account.Bytes()...)
+	it := idx.db.NewIterator(prefix, encodeUint64(math.MaxUint64-(before-1)))
+	defer it.Release()
+	for len(txs) < limit && it.Next() {
+		var requestId common.Hash
+		copy(requestId[:], it.Value())
+		txs = append(txs, AddressTx{
+			LogIndex:  math.MaxUint64 - binary.BigEndian.Uint64(it.Key()[len(prefix):]),
+			RequestId: requestId,
+		})
+	}
+	return txs, it.Error()
+}
+
+// GetTransactionsByAddress returns up to limit of the account's transactions
+// with log indexes below before, most recent first
+func (db *TxDB) GetTransactionsByAddress(account common.Address, before uint64, limit int) ([]AddressTx, error) {
+	if db.addresses == nil {
+		return nil, errAddressIndexDisabled
+	}
+	return db.addresses.transactions(account, before, limit)
+}
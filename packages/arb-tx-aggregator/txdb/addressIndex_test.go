@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+func TestAddressIndex(t *testing.T) {
+	result := func(sender common.Address, dest common.Address, requestId common.Hash, code evm.ResultType) *evm.TxResult {
+		l2, err := message.NewL2Message(message.Transaction{
+			MaxGas:      big.NewInt(100000),
+			GasPriceBid: big.NewInt(0),
+			SequenceNum: big.NewInt(0),
+			DestAddress: dest,
+			Payment:     big.NewInt(0),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &evm.TxResult{
+			IncomingRequest: evm.IncomingRequest{
+				Kind:      message.L2Type,
+				Sender:    sender,
+				MessageID: requestId,
+				Data:      l2.AsData(),
+				ChainTime: inbox.ChainTime{BlockNum: common.NewTimeBlocksInt(0)},
+			},
+			ResultCode:    code,
+			ReturnData:    make([]byte, 32),
+			TxIndex:       big.NewInt(0),
+			StartLogIndex: big.NewInt(0),
+			GasUsed:       big.NewInt(0),
+			CumulativeGas: big.NewInt(0),
+		}
+	}
+	deposit := func(sender common.Address, dest common.Address, requestId common.Hash) *evm.TxResult {
+		msg := message.Eth{Dest: dest, Value: big.NewInt(5)}
+		return &evm.TxResult{
+			IncomingRequest: evm.IncomingRequest{
+				Kind:      msg.Type(),
+				Sender:    sender,
+				MessageID: requestId,
+				Data:      msg.AsData(),
+			},
+			ResultCode: evm.ReturnCode,
+		}
+	}
+	checkTxs := func(idx *addressIndex, account common.Address, before uint64, limit int, expected ...uint64) {
+		t.Helper()
+		txs, err := idx.transactions(account, before, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(txs) != len(expected) {
+			t.Fatal("unexpected transactions", txs, "expected logs", expected)
+		}
+		for i, tx := range txs {
+			if tx.LogIndex != expected[i] || tx.RequestId != (common.Hash{byte(expected[i])}) {
+				t.Fatal("unexpected transactions", txs, "expected logs", expected)
+			}
+		}
+	}
+
+	alice := common.Address{1}
+	bob := common.Address{2}
+	contract := common.Address{3}
+	creation := result(bob, common.Address{}, common.Hash{6}, evm.ReturnCode)
+	copy(creation.ReturnData[12:], contract[:])
+
+	idx := newAddressIndex(rawdb.NewMemoryDatabase())
+	if err := idx.addResults(3, []*evm.TxResult{
+		result(alice, common.Address{9}, common.Hash{3}, evm.ReturnCode),
+		deposit(bob, alice, common.Hash{4}),
+		result(alice, bob, common.Hash{5}, evm.BadSequenceCode),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.addResults(6, []*evm.TxResult{
+		creation,
+		result(alice, contract, common.Hash{7}, evm.RevertCode),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTxs(idx, alice, math.MaxUint64, 10, 7, 4, 3)
+	checkTxs(idx, bob, math.MaxUint64, 10, 6, 4)
+	checkTxs(idx, contract, math.MaxUint64, 10, 7, 6)
+	checkTxs(idx, common.Address{9}, math.MaxUint64, 10, 3)
+
+	// Paginate through alice's history
+	checkTxs(idx, alice, math.MaxUint64, 2, 7, 4)
+	checkTxs(idx, alice, 4, 2, 3)
+	checkTxs(idx, alice, 3, 2)
+	checkTxs(idx, alice, 0, 2)
+
+	// A reorg removes every log from index 4 onwards
+	if err := idx.rollback(4); err != nil {
+		t.Fatal(err)
+	}
+	checkTxs(idx, alice, math.MaxUint64, 10, 3)
+	checkTxs(idx, bob, math.MaxUint64, 10)
+	checkTxs(idx, contract, math.MaxUint64, 10)
+
+	if err := idx.addResults(4, []*evm.TxResult{deposit(alice, bob, common.Hash{4})}); err != nil {
+		t.Fatal(err)
+	}
+	checkTxs(idx, alice, math.MaxUint64, 10, 4, 3)
+	checkTxs(idx, bob, math.MaxUint64, 10, 4)
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+var archiveBatchPrefix = []byte("archiveBatch")
+
+// ArchiveConfig enables rebuilding the state at heights whose snapshots are
+// no longer cached
+type ArchiveConfig struct {
+	// CheckpointInterval is the number of L1 blocks in each span which keeps
+	// a machine checkpoint. Rebuilding state re-executes at most this many
+	// blocks of messages
+	CheckpointInterval uint64
+
+	// CacheSize is the number of rebuilt snapshots kept in memory
+	CacheSize int
+}
+
+func DefaultArchiveConfig() ArchiveConfig {
+	return ArchiveConfig{
+		CheckpointInterval: 1000,
+		CacheSize:          100,
+	}
+}
+
+// ArchiveCheckpointer restores the latest machine checkpoint at or before a
+// given height
+type ArchiveCheckpointer interface {
+	RestoreStateAt(
+		ctx context.Context,
+		clnt arbbridge.ChainTimeGetter,
+		height *common.TimeBlocks,
+		unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+	) error
+}
+
+type archivedMessage struct {
+	Kind        uint8
+	Sender      common.Address
+	InboxSeqNum *big.Int
+	Data        []byte
+	BlockNum    *big.Int
+	Timestamp   *big.Int
+}
+
+func (msg archivedMessage) inboxMessage() inbox.InboxMessage {
+	return inbox.InboxMessage{
+		Kind:        inbox.Type(msg.Kind),
+		Sender:      msg.Sender,
+		InboxSeqNum: msg.InboxSeqNum,
+		Data:        msg.Data,
+		ChainTime: inbox.ChainTime{
+			BlockNum:  common.NewTimeBlocks(msg.BlockNum),
+			Timestamp: msg.Timestamp,
+		},
+	}
+}
+
+// archivedBatch holds the messages passed to a single call of AddMessages,
+// which must be executed together for the machine to reach the same state
+type archivedBatch struct {
+	Messages []archivedMessage
+
+	// Timestamp is the timestamp of the L1 block that the batch finished at
+	Timestamp *big.Int
+}
+
+// archive stores every batch of inbox messages keyed by the L1 block the
+// batch finished at, along with an LRU of snapshots rebuilt from them.
+//
+// Unlike the other indexes, batches from blocks that were reorged out are
+// deleted when the TxDB is reloaded since the replacement batches may finish
+// at different heights
+type archive struct {
+	db    ethdb.Database
+	snaps *lru.Cache
+}
+
+func newArchive(db ethdb.Database, cacheSize int) *archive {
+	if cacheSize <= 0 {
+		panic("must use cache size greater than 0")
+	}
+	// Size already verified above, so error can be ignored
+	snaps, _ := lru.New(cacheSize)
+	return &archive{db: db, snaps: snaps}
+}
+
+func archiveBatchKey(height uint64) []byte {
+	return append(append([]byte{}, archiveBatchPrefix...), encodeUint64(height)...)
+}
+
+func (a *archive) addBatch(msgs []arbbridge.MessageDeliveredEvent, finishedHeight uint64, timestamp *big.Int) error {
+	batch := archivedBatch{
+		Messages:  make([]archivedMessage, 0, len(msgs)),
+		Timestamp: timestamp,
+	}
+	for _, msg := range msgs {
+		batch.Messages = append(batch.Messages, archivedMessage{
+			Kind:        uint8(msg.Message.Kind),
+			Sender:      msg.Message.Sender,
+			InboxSeqNum: msg.Message.InboxSeqNum,
+			Data:        msg.Message.Data,
+			BlockNum:    msg.Message.ChainTime.BlockNum.AsInt(),
+			Timestamp:   msg.Message.ChainTime.Timestamp,
+		})
+	}
+	data, err := rlp.EncodeToBytes(batch)
+	if err != nil {
+		return err
+	}
+	return a.db.Put(archiveBatchKey(finishedHeight), data)
+}
+
+// removeBatchesFrom deletes the batches which finished at or after height and
+// clears the rebuilt snapshots
+func (a *archive) removeBatchesFrom(height uint64) error {
+	it := a.db.NewIterator(archiveBatchPrefix, encodeUint64(height))
+	defer it.Release()
+	batch := a.db.NewBatch()
+	for it.Next() {
+		if err := batch.Delete(append([]byte{}, it.Key()...)); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	a.snaps.Purge()
+	return nil
+}
+
+// forEachBatch calls f in order with the batches which finished at or after
+// height until f returns false
+func (a *archive) forEachBatch(height uint64, f func(finishedHeight uint64, batch *archivedBatch) bool) error {
+	it := a.db.NewIterator(archiveBatchPrefix, encodeUint64(height))
+	defer it.Release()
+	for it.Next() {
+		batch := new(archivedBatch)
+		if err := rlp.DecodeBytes(it.Value(), batch); err != nil {
+			return err
+		}
+		if !f(binary.BigEndian.Uint64(it.Key()[len(archiveBatchPrefix):]), batch) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// archiveReplay re-executes archived batches and keeps the latest snapshot
+// at or before its target height
+type archiveReplay struct {
+	db           *TxDB
+	mach         machine.Machine
+	lastInboxSeq *big.Int
+	target       *big.Int
+	best         *snapshot.Snapshot
+}
+
+// addSnap returns false once the machine has passed the target height
+func (r *archiveReplay) addSnap(blockNum *big.Int, timestamp *big.Int) bool {
+	if blockNum.Cmp(r.target) > 0 {
+		return false
+	}
+	currentTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocks(new(big.Int).Set(blockNum)),
+		Timestamp: new(big.Int).Set(timestamp),
+	}
+	r.best = snapshot.NewSnapshot(r.mach.Clone(), currentTime, message.ChainAddressToID(r.db.chain), new(big.Int).Set(r.lastInboxSeq))
+	return true
+}
+
+func (r *archiveReplay) addAssertionBlocks(processed processedAssertion) bool {
+	if len(processed.blocks) == 0 {
+		return true
+	}
+	block := processed.blocks[len(processed.blocks)-1]
+	return r.addSnap(block.BlockNum, block.Timestamp)
+}
+
+// run executes a batch the same way AddMessages did originally and returns
+// false once the machine has passed the target height
+func (r *archiveReplay) run(finishedHeight uint64, batch *archivedBatch) (bool, error) {
+	for _, msg := range batch.Messages {
+		// Last value returned is not an error type
+		assertion, _ := r.mach.ExecuteAssertion(1000000000000, []inbox.InboxMessage{msg.inboxMessage()}, 0)
+		r.lastInboxSeq = msg.InboxSeqNum
+		processed, err := r.db.processAssertion(assertion)
+		if err != nil {
+			return false, err
+		}
+		if !r.addAssertionBlocks(processed) {
+			return false, nil
+		}
+	}
+
+	finished := new(big.Int).SetUint64(finishedHeight)
+	nextBlockHeight := new(big.Int).Add(finished, big.NewInt(1))
+	// Last value returned is not an error type
+	assertion, _ := r.mach.ExecuteCallServerAssertion(1000000000000, nil, value.NewIntValue(nextBlockHeight), 0)
+	processed, err := r.db.processAssertion(assertion)
+	if err != nil {
+		return false, err
+	}
+	if !r.addAssertionBlocks(processed) {
+		return false, nil
+	}
+	if r.best.Height().AsInt().Cmp(finished) < 0 {
+		return r.addSnap(finished, batch.Timestamp), nil
+	}
+	return true, nil
+}
+
+// rebuildSnapshot restores the latest machine checkpoint at or before the
+// given time and re-executes the archived inbox messages up to it
+func (db *TxDB) rebuildSnapshot(ctx context.Context, time inbox.ChainTime) (*snapshot.Snapshot, error) {
+	height := time.BlockNum.AsInt().Uint64()
+	if snap, ok := db.archive.snaps.Get(height); ok {
+		return advanceSnapshot(snap.(*snapshot.Snapshot), time), nil
+	}
+
+	cp, ok := db.checkpointer.(ArchiveCheckpointer)
+	if !ok {
+		return nil, errors.New("checkpointer doesn't support archive mode")
+	}
+	var mach machine.Machine
+	var lastInboxSeq *big.Int
+	var blockId *common.BlockId
+	if err := cp.RestoreStateAt(ctx, db.timeGetter, time.BlockNum, func(chainObserverBytes []byte, restoreCtx ckptcontext.RestoreContext, restoreBlockId *common.BlockId) error {
+		var err error
+		mach, lastInboxSeq, err = unmarshalCheckpoint(chainObserverBytes, restoreCtx)
+		blockId = restoreBlockId
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	timestamp, err := db.timeGetter.TimestampForBlockHash(ctx, blockId.HeaderHash)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &archiveReplay{
+		db:           db,
+		mach:         mach,
+		lastInboxSeq: lastInboxSeq,
+		target:       time.BlockNum.AsInt(),
+	}
+	replay.addSnap(blockId.Height.AsInt(), timestamp)
+	var replayErr error
+	err = db.archive.forEachBatch(blockId.Height.AsInt().Uint64()+1, func(finishedHeight uint64, batch *archivedBatch) bool {
+		var ok bool
+		ok, replayErr = replay.run(finishedHeight, batch)
+		return ok && replayErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replayErr != nil {
+		return nil, replayErr
+	}
+
+	db.archive.snaps.Add(height, replay.best)
+	return advanceSnapshot(replay.best, time), nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+func TestArchiveBatches(t *testing.T) {
+	delivered := func() arbbridge.MessageDeliveredEvent {
+		return arbbridge.MessageDeliveredEvent{Message: inbox.NewRandomInboxMessage()}
+	}
+	checkHeights := func(a *archive, start uint64, expected ...uint64) {
+		t.Helper()
+		var heights []uint64
+		if err := a.forEachBatch(start, func(finishedHeight uint64, _ *archivedBatch) bool {
+			heights = append(heights, finishedHeight)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(heights) != len(expected) {
+			t.Fatal("unexpected batch heights", heights, "expected", expected)
+		}
+		for i := range heights {
+			if heights[i] != expected[i] {
+				t.Fatal("unexpected batch heights", heights, "expected", expected)
+			}
+		}
+	}
+
+	a := newArchive(rawdb.NewMemoryDatabase(), 10)
+	msgs := []arbbridge.MessageDeliveredEvent{delivered(), delivered()}
+	if err := a.addBatch(msgs, 300, big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.addBatch(nil, 5, big.NewInt(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.addBatch(nil, 20, big.NewInt(4)); err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(a, 0, 5, 20, 300)
+	checkHeights(a, 6, 20, 300)
+
+	var batch *archivedBatch
+	if err := a.forEachBatch(21, func(_ uint64, b *archivedBatch) bool {
+		batch = b
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if batch == nil || batch.Timestamp.Int64() != 7 || len(batch.Messages) != len(msgs) {
+		t.Fatal("unexpected batch", batch)
+	}
+	for i, msg := range batch.Messages {
+		if !msg.inboxMessage().Equals(msgs[i].Message) {
+			t.Error("archived message", i, "doesn't match")
+		}
+	}
+
+	if err := a.removeBatchesFrom(20); err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(a, 0, 5)
+}
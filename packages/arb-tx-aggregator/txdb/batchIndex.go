@@ -0,0 +1,176 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+var (
+	inboxOriginPrefix  = []byte("inboxOrigin")
+	inboxL1TxPrefix    = []byte("inboxL1Tx")
+	inboxRequestPrefix = []byte("inboxRequest")
+)
+
+// InboxMessageOrigin describes the L1 transaction which delivered an inbox
+// message
+type InboxMessageOrigin struct {
+	InboxSeqNum *big.Int
+	Kind        uint8
+	Sender      common.Address
+	TxHash      common.Hash
+	BlockHash   common.Hash
+	BlockNum    *big.Int
+	LogIndex    uint64
+}
+
+type inboxRequest struct {
+	logIndex  uint64
+	requestId common.Hash
+}
+
+// batchIndex links inbox messages to the L1 transactions that delivered them
+// and to the L2 requests that resulted from executing them.
+//
+// Entries are never removed after a reorg. Requests are checked against the
+// aggregator store when they are read, and an inbox message that is delivered
+// again replaces its previous origin
+type batchIndex struct {
+	db ethdb.Database
+}
+
+func newBatchIndex(db ethdb.Database) *batchIndex {
+	return &batchIndex{db: db}
+}
+
+func inboxOriginKey(seqNum *big.Int) []byte {
+	return append(append([]byte{}, inboxOriginPrefix...), math.U256Bytes(new(big.Int).Set(seqNum))...)
+}
+
+func inboxL1TxKey(txHash common.Hash, seqNum *big.Int) []byte {
+	key := append(append([]byte{}, inboxL1TxPrefix...), txHash.Bytes()...)
+	return append(key, math.U256Bytes(new(big.Int).Set(seqNum))...)
+}
+
+func inboxRequestKey(seqNum *big.Int, logIndex uint64) []byte {
+	key := append([]byte{}, inboxRequestPrefix...)
+	key = append(key, math.U256Bytes(new(big.Int).Set(seqNum))...)
+	return append(key, encodeUint64(logIndex)...)
+}
+
+func (idx *batchIndex) addMessages(msgs []arbbridge.MessageDeliveredEvent) error {
+	batch := idx.db.NewBatch()
+	for _, msg := range msgs {
+		seqNum := msg.Message.InboxSeqNum
+		old, err := idx.origin(seqNum)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.TxHash != msg.TxHash {
+			if err := batch.Delete(inboxL1TxKey(old.TxHash, seqNum)); err != nil {
+				return err
+			}
+		}
+		data, err := rlp.EncodeToBytes(InboxMessageOrigin{
+			InboxSeqNum: seqNum,
+			Kind:        uint8(msg.Message.Kind),
+			Sender:      msg.Message.Sender,
+			TxHash:      msg.TxHash,
+			BlockHash:   msg.BlockId.HeaderHash,
+			BlockNum:    msg.BlockId.Height.AsInt(),
+			LogIndex:    uint64(msg.LogIndex),
+		})
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(inboxOriginKey(seqNum), data); err != nil {
+			return err
+		}
+		if err := batch.Put(inboxL1TxKey(msg.TxHash, seqNum), []byte{}); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// addRequests records the inbox message that each result came from.
+// startLog is the log index of the first result
+func (idx *batchIndex) addRequests(startLog uint64, results []*evm.TxResult) error {
+	batch := idx.db.NewBatch()
+	for i, res := range results {
+		key := inboxRequestKey(res.IncomingRequest.Provenance.L1SeqNum, startLog+uint64(i))
+		if err := batch.Put(key, res.IncomingRequest.MessageID.Bytes()); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// origin returns nil if the inbox message hasn't been indexed
+func (idx *batchIndex) origin(seqNum *big.Int) (*InboxMessageOrigin, error) {
+	key := inboxOriginKey(seqNum)
+	has, err := idx.db.Has(key)
+	if err != nil || !has {
+		return nil, err
+	}
+	data, err := idx.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	origin := new(InboxMessageOrigin)
+	if err := rlp.DecodeBytes(data, origin); err != nil {
+		return nil, err
+	}
+	return origin, nil
+}
+
+// messagesInL1Tx returns the sequence numbers of the inbox messages delivered
+// by the given L1 transaction in increasing order
+func (idx *batchIndex) messagesInL1Tx(txHash common.Hash) ([]*big.Int, error) {
+	prefix := append(append([]byte{}, inboxL1TxPrefix...), txHash.Bytes()...)
+	it := idx.db.NewIterator(prefix, nil)
+	defer it.Release()
+	var seqNums []*big.Int
+	for it.Next() {
+		seqNums = append(seqNums, new(big.Int).SetBytes(it.Key()[len(prefix):]))
+	}
+	return seqNums, it.Error()
+}
+
+// requests returns the requests which resulted from the inbox message
+// ordered by log index
+func (idx *batchIndex) requests(seqNum *big.Int) ([]inboxRequest, error) {
+	prefix := append(append([]byte{}, inboxRequestPrefix...), math.U256Bytes(new(big.Int).Set(seqNum))...)
+	it := idx.db.NewIterator(prefix, nil)
+	defer it.Release()
+	var requests []inboxRequest
+	for it.Next() {
+		req := inboxRequest{logIndex: binary.BigEndian.Uint64(it.Key()[len(prefix):])}
+		copy(req.requestId[:], it.Value())
+		requests = append(requests, req)
+	}
+	return requests, it.Error()
+}
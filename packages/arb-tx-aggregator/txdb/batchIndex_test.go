@@ -0,0 +1,127 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+func TestBatchIndex(t *testing.T) {
+	delivered := func(seqNum int64, txHash common.Hash, logIndex uint) arbbridge.MessageDeliveredEvent {
+		return arbbridge.MessageDeliveredEvent{
+			ChainInfo: arbbridge.ChainInfo{
+				BlockId: &common.BlockId{
+					Height:     common.NewTimeBlocks(big.NewInt(50)),
+					HeaderHash: common.Hash{9},
+				},
+				LogIndex: logIndex,
+			},
+			TxHash: txHash,
+			Message: inbox.InboxMessage{
+				Kind:        inbox.Type(3),
+				Sender:      common.Address{4},
+				InboxSeqNum: big.NewInt(seqNum),
+			},
+		}
+	}
+	result := func(seqNum int64, requestId common.Hash) *evm.TxResult {
+		return &evm.TxResult{
+			IncomingRequest: evm.IncomingRequest{
+				MessageID:  requestId,
+				Provenance: evm.Provenance{L1SeqNum: big.NewInt(seqNum)},
+			},
+		}
+	}
+
+	idx := newBatchIndex(rawdb.NewMemoryDatabase())
+	l1Tx := common.Hash{1}
+	if err := idx.addMessages([]arbbridge.MessageDeliveredEvent{
+		delivered(256, l1Tx, 2),
+		delivered(7, l1Tx, 1),
+		delivered(8, common.Hash{2}, 0),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	seqNums, err := idx.messagesInL1Tx(l1Tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqNums) != 2 || seqNums[0].Int64() != 7 || seqNums[1].Int64() != 256 {
+		t.Fatal("unexpected messages in l1 tx", seqNums)
+	}
+
+	origin, err := idx.origin(big.NewInt(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin == nil ||
+		origin.TxHash != l1Tx ||
+		origin.InboxSeqNum.Int64() != 256 ||
+		origin.BlockNum.Int64() != 50 ||
+		origin.BlockHash != (common.Hash{9}) ||
+		origin.LogIndex != 2 ||
+		origin.Kind != 3 ||
+		origin.Sender != (common.Address{4}) {
+		t.Fatal("unexpected origin", origin)
+	}
+	origin, err = idx.origin(big.NewInt(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin != nil {
+		t.Fatal("found origin of unknown message")
+	}
+
+	// Redelivering a message in a different L1 transaction after a reorg
+	// moves it to the new transaction
+	if err := idx.addMessages([]arbbridge.MessageDeliveredEvent{delivered(7, common.Hash{3}, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	seqNums, err = idx.messagesInL1Tx(l1Tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqNums) != 1 || seqNums[0].Int64() != 256 {
+		t.Fatal("unexpected messages in l1 tx after redelivery", seqNums)
+	}
+
+	if err := idx.addRequests(10, []*evm.TxResult{
+		result(256, common.Hash{10}),
+		result(8, common.Hash{11}),
+		result(256, common.Hash{12}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := idx.requests(big.NewInt(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 ||
+		requests[0] != (inboxRequest{logIndex: 10, requestId: common.Hash{10}}) ||
+		requests[1] != (inboxRequest{logIndex: 12, requestId: common.Hash{12}}) {
+		t.Fatal("unexpected requests", requests)
+	}
+}
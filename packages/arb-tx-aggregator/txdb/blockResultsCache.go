@@ -0,0 +1,57 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+// blockResultsCache holds the decoded results of recently requested blocks.
+// Entries are keyed by block hash so a block replaced by a reorg is never
+// served from the cache
+type blockResultsCache struct {
+	cache *lru.Cache
+}
+
+func newBlockResultsCache(size int) *blockResultsCache {
+	if size <= 0 {
+		panic("must use cache size greater than 0")
+	}
+	// Size already verified above, so error can be ignored
+	cache, _ := lru.New(size)
+	return &blockResultsCache{cache: cache}
+}
+
+// getOrDecode returns the cached results of the block, calling decode and
+// caching its results if the block isn't cached. The returned slice is shared
+// between callers, so its capacity is limited to its length so that appending
+// to it can't overwrite the cached entry
+func (c *blockResultsCache) getOrDecode(blockHash ethcommon.Hash, decode func() ([]*evm.TxResult, error)) ([]*evm.TxResult, error) {
+	if results, ok := c.cache.Get(blockHash); ok {
+		return results.([]*evm.TxResult), nil
+	}
+	results, err := decode()
+	if err != nil {
+		return nil, err
+	}
+	results = results[:len(results):len(results)]
+	c.cache.Add(blockHash, results)
+	return results, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+func TestBlockResultsCache(t *testing.T) {
+	cache := newBlockResultsCache(2)
+	decodes := make(map[ethcommon.Hash]int)
+	decoder := func(blockHash ethcommon.Hash) func() ([]*evm.TxResult, error) {
+		return func() ([]*evm.TxResult, error) {
+			decodes[blockHash]++
+			results := make([]*evm.TxResult, 0, 10)
+			for i := 0; i < 2; i++ {
+				results = append(results, &evm.TxResult{TxIndex: big.NewInt(int64(i))})
+			}
+			return results, nil
+		}
+	}
+
+	block := ethcommon.Hash{1}
+	first, err := cache.getOrDecode(block, decoder(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		results, err := cache.getOrDecode(block, decoder(block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0] != first[0] || results[1] != first[1] {
+			t.Fatal("cached results differ")
+		}
+	}
+	if decodes[block] != 1 {
+		t.Error("block decoded", decodes[block], "times")
+	}
+
+	// Appending to the shared results must not change the cached entry
+	_ = append(first, &evm.TxResult{TxIndex: big.NewInt(5)})
+	results, err := cache.getOrDecode(block, decoder(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || cap(results) != 2 {
+		t.Error("cached results modified")
+	}
+
+	// A block replaced by a reorg has a different hash so it's decoded
+	// separately
+	other := ethcommon.Hash{2}
+	if _, err := cache.getOrDecode(other, decoder(other)); err != nil {
+		t.Fatal(err)
+	}
+	if decodes[other] != 1 || decodes[block] != 1 {
+		t.Error("unexpected decodes", decodes)
+	}
+
+	// Failures aren't cached
+	failed := ethcommon.Hash{3}
+	decodeErr := errors.New("decode failed")
+	if _, err := cache.getOrDecode(failed, func() ([]*evm.TxResult, error) {
+		return nil, decodeErr
+	}); err != decodeErr {
+		t.Fatal("expected decode error but got", err)
+	}
+	if _, err := cache.getOrDecode(failed, decoder(failed)); err != nil {
+		t.Fatal(err)
+	}
+	if decodes[failed] != 1 {
+		t.Error("failed block decoded", decodes[failed], "times")
+	}
+}
@@ -0,0 +1,422 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	// bloomSectionSize is the number of blocks covered by each section of
+	// the bloombits index
+	bloomSectionSize = 4096
+
+	// bloomFilterThreads is the number of goroutines used per filter session
+	// to multiplex retrieval requests
+	bloomFilterThreads = 3
+
+	// bloomRetrievalBatch is the maximum number of bloom bit retrievals to
+	// service in a single batch
+	bloomRetrievalBatch = 16
+
+	// bloomRetrievalWait is the maximum time to wait for enough bloom bit
+	// requests to accumulate a full batch
+	bloomRetrievalWait = time.Duration(0)
+)
+
+var (
+	bloomFirstSectionKey = []byte("bloomFirstSection")
+	bloomSectionsKey     = []byte("bloomSections")
+)
+
+type headerGetter func(height uint64) (*types.Header, error)
+
+// bloomIndex maintains a section based bloombits index over the headers saved
+// by the TxDB in the same format used by go-ethereum so that it can be
+// queried using a bloombits.Matcher.
+//
+// Every section below firstSection precedes the first block of the chain and
+// is treated as empty. Sections from firstSection up to sections are stored
+// in the database keyed by the hash of the last header in the section. The
+// blooms of the blocks in the current incomplete section are kept in gen and
+// rebuilt from the block store on load.
+type bloomIndex struct {
+	sync.Mutex
+	db          ethdb.Database
+	getHeader   headerGetter
+	sectionSize uint64
+
+	initialized  bool
+	firstSection uint64
+	sections     uint64
+
+	gen  *bloombits.Generator
+	next uint64
+}
+
+func newBloomIndex(db ethdb.Database, getHeader headerGetter, sectionSize uint64) *bloomIndex {
+	return &bloomIndex{
+		db:          db,
+		getHeader:   getHeader,
+		sectionSize: sectionSize,
+	}
+}
+
+// status returns the section size and the number of fully indexed sections
+func (idx *bloomIndex) status() (uint64, uint64) {
+	idx.Lock()
+	defer idx.Unlock()
+	return idx.sectionSize, idx.sections
+}
+
+// load restores the index state from the database and rebuilds the current
+// section up to and including the block at latest. If latest is nil the block
+// store is empty and the index is cleared
+func (idx *bloomIndex) load(latest *uint64) error {
+	idx.Lock()
+	defer idx.Unlock()
+
+	firstSection, err := readUint64(idx.db, bloomFirstSectionKey)
+	if err != nil {
+		return err
+	}
+	sections, err := readUint64(idx.db, bloomSectionsKey)
+	if err != nil {
+		return err
+	}
+
+	if latest == nil {
+		return idx.clearLocked()
+	}
+
+	if firstSection == nil || sections == nil {
+		// This database predates the index so we need to find where the
+		// chain starts and index everything from there
+		first, err := idx.findFirstBlock(*latest)
+		if err != nil {
+			return err
+		}
+		log.Println("Building bloom index from block", first, "to block", *latest)
+		if err := idx.initializeLocked(first / idx.sectionSize); err != nil {
+			return err
+		}
+	} else {
+		idx.initialized = true
+		idx.firstSection = *firstSection
+		idx.sections = *sections
+	}
+	return idx.resetLocked(*latest)
+}
+
+// reset discards any indexed data past the given height and rebuilds the
+// current section from the block store
+func (idx *bloomIndex) reset(height uint64) error {
+	idx.Lock()
+	defer idx.Unlock()
+	return idx.resetLocked(height)
+}
+
+// addHeader adds the bloom of the given header to the index. The header must
+// already be saved in the block store. Headers are expected to be added in
+// order, but if a header is added at a height that was already indexed, the
+// index is rolled back to that height
+func (idx *bloomIndex) addHeader(header *types.Header) error {
+	idx.Lock()
+	defer idx.Unlock()
+
+	height := header.Number.Uint64()
+	if !idx.initialized {
+		if err := idx.initializeLocked(height / idx.sectionSize); err != nil {
+			return err
+		}
+	} else if height < idx.next {
+		return idx.resetLocked(height)
+	}
+
+	for idx.next < height {
+		// Any blocks missing from before the first block are empty
+		if err := idx.addBloomLocked(types.Bloom{}); err != nil {
+			return err
+		}
+	}
+	return idx.addBloomLocked(header.Bloom)
+}
+
+func (idx *bloomIndex) initializeLocked(firstSection uint64) error {
+	batch := idx.db.NewBatch()
+	if err := batch.Put(bloomFirstSectionKey, encodeUint64(firstSection)); err != nil {
+		return err
+	}
+	if err := batch.Put(bloomSectionsKey, encodeUint64(firstSection)); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	idx.initialized = true
+	idx.firstSection = firstSection
+	idx.sections = firstSection
+	return idx.newSectionLocked()
+}
+
+func (idx *bloomIndex) clearLocked() error {
+	if err := idx.db.Delete(bloomFirstSectionKey); err != nil {
+		return err
+	}
+	if err := idx.db.Delete(bloomSectionsKey); err != nil {
+		return err
+	}
+	idx.initialized = false
+	idx.firstSection = 0
+	idx.sections = 0
+	idx.gen = nil
+	idx.next = 0
+	return nil
+}
+
+func (idx *bloomIndex) resetLocked(height uint64) error {
+	if !idx.initialized {
+		return nil
+	}
+	if height < idx.firstSection*idx.sectionSize {
+		return idx.clearLocked()
+	}
+
+	validSections := (height + 1) / idx.sectionSize
+	if validSections < idx.sections {
+		idx.sections = validSections
+		if err := idx.db.Put(bloomSectionsKey, encodeUint64(idx.sections)); err != nil {
+			return err
+		}
+	}
+	if err := idx.newSectionLocked(); err != nil {
+		return err
+	}
+	for idx.next <= height {
+		header, err := idx.getHeader(idx.next)
+		if err != nil {
+			return err
+		}
+		bloom := types.Bloom{}
+		if header != nil {
+			bloom = header.Bloom
+		}
+		if err := idx.addBloomLocked(bloom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *bloomIndex) newSectionLocked() error {
+	gen, err := bloombits.NewGenerator(uint(idx.sectionSize))
+	if err != nil {
+		return err
+	}
+	idx.gen = gen
+	idx.next = idx.sections * idx.sectionSize
+	return nil
+}
+
+func (idx *bloomIndex) addBloomLocked(bloom types.Bloom) error {
+	sectionStart := idx.sections * idx.sectionSize
+	if err := idx.gen.AddBloom(uint(idx.next-sectionStart), bloom); err != nil {
+		return err
+	}
+	idx.next++
+	if idx.next < sectionStart+idx.sectionSize {
+		return nil
+	}
+	return idx.commitLocked()
+}
+
+func (idx *bloomIndex) commitLocked() error {
+	head, err := idx.sectionHead(idx.sections)
+	if err != nil {
+		return err
+	}
+	batch := idx.db.NewBatch()
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, err := idx.gen.Bitset(uint(i))
+		if err != nil {
+			return err
+		}
+		rawdb.WriteBloomBits(batch, uint(i), idx.sections, head.Hash(), bitutil.CompressBytes(bits))
+	}
+	if err := batch.Put(bloomSectionsKey, encodeUint64(idx.sections+1)); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	idx.sections++
+	return idx.newSectionLocked()
+}
+
+func (idx *bloomIndex) sectionHead(section uint64) (*types.Header, error) {
+	height := (section+1)*idx.sectionSize - 1
+	header, err := idx.getHeader(height)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("no header saved at height %v for bloom section %v", height, section)
+	}
+	return header, nil
+}
+
+// findFirstBlock does a binary search for the lowest height that has a block
+// saved. Blocks are saved contiguously from the first block to latest
+func (idx *bloomIndex) findFirstBlock(latest uint64) (uint64, error) {
+	low := uint64(0)
+	high := latest
+	for low < high {
+		mid := low + (high-low)/2
+		header, err := idx.getHeader(mid)
+		if err != nil {
+			return 0, err
+		}
+		if header == nil {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+func (idx *bloomIndex) retrieve(task *bloombits.Retrieval) {
+	idx.Lock()
+	firstSection := idx.firstSection
+	sections := idx.sections
+	idx.Unlock()
+
+	task.Bitsets = make([][]byte, len(task.Sections))
+	for i, section := range task.Sections {
+		if section < firstSection {
+			// No blocks exist in sections before the start of the chain
+			task.Bitsets[i] = make([]byte, idx.sectionSize/8)
+			continue
+		}
+		if section >= sections {
+			task.Error = fmt.Errorf("bloom section %v has not been indexed", section)
+			return
+		}
+		head, err := idx.sectionHead(section)
+		if err != nil {
+			task.Error = err
+			return
+		}
+		compVector, err := rawdb.ReadBloomBits(idx.db, task.Bit, section, head.Hash())
+		if err != nil {
+			task.Error = err
+			return
+		}
+		blob, err := bitutil.DecompressBytes(compVector, int(idx.sectionSize/8))
+		if err != nil {
+			task.Error = err
+			return
+		}
+		task.Bitsets[i] = blob
+	}
+}
+
+// serviceFilter services the bloom bit retrievals of the given session until
+// ctx is done
+func (idx *bloomIndex) serviceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	requests := make(chan chan *bloombits.Retrieval)
+	for i := 0; i < bloomFilterThreads; i++ {
+		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, requests)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case request := <-requests:
+				task := <-request
+				idx.retrieve(task)
+				request <- task
+			}
+		}
+	}()
+}
+
+// matchingBlocks returns the heights of all blocks between begin and end
+// inclusive whose bloom may match the given filter. All blocks in the range
+// must already be indexed
+func (idx *bloomIndex) matchingBlocks(ctx context.Context, begin, end uint64, filters [][][]byte) ([]uint64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matcher := bloombits.NewMatcher(idx.sectionSize, filters)
+	matches := make(chan uint64, 64)
+	session, err := matcher.Start(ctx, begin, end, matches)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	idx.serviceFilter(ctx, session)
+
+	var heights []uint64
+	for {
+		select {
+		case height, ok := <-matches:
+			if !ok {
+				return heights, session.Error()
+			}
+			heights = append(heights, height)
+		case <-ctx.Done():
+			return nil, errors.New("call timed out")
+		}
+	}
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
+}
+
+func readUint64(db ethdb.KeyValueReader, key []byte) (*uint64, error) {
+	has, err := db.Has(key)
+	if err != nil || !has {
+		return nil, err
+	}
+	data, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 8 {
+		return nil, fmt.Errorf("unexpected value length %v for key %s", len(data), key)
+	}
+	val := binary.BigEndian.Uint64(data)
+	return &val, nil
+}
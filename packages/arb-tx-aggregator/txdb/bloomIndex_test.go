@@ -0,0 +1,132 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type testHeaderStore struct {
+	headers map[uint64]*types.Header
+}
+
+func (s *testHeaderStore) getHeader(height uint64) (*types.Header, error) {
+	return s.headers[height], nil
+}
+
+func (s *testHeaderStore) addHeader(height uint64, addresses ...ethcommon.Address) *types.Header {
+	var bloom types.Bloom
+	for _, addr := range addresses {
+		bloom.Add(addr.Bytes())
+	}
+	header := &types.Header{
+		Number: new(big.Int).SetUint64(height),
+		Bloom:  bloom,
+	}
+	s.headers[height] = header
+	return header
+}
+
+func TestBloomIndex(t *testing.T) {
+	const sectionSize = 16
+	const firstBlock = 37
+	const lastBlock = 100
+
+	addr := ethcommon.Address{5}
+	matchingHeights := map[uint64]bool{40: true, 63: true, 64: true, 90: true}
+
+	store := &testHeaderStore{headers: make(map[uint64]*types.Header)}
+	db := rawdb.NewMemoryDatabase()
+	idx := newBloomIndex(db, store.getHeader, sectionSize)
+	if err := idx.load(nil); err != nil {
+		t.Fatal(err)
+	}
+	for height := uint64(firstBlock); height <= lastBlock; height++ {
+		var header *types.Header
+		if matchingHeights[height] {
+			header = store.addHeader(height, addr)
+		} else {
+			header = store.addHeader(height, ethcommon.Address{byte(height)})
+		}
+		if err := idx.addHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkMatches := func(idx *bloomIndex) {
+		size, sections := idx.status()
+		if size != sectionSize || sections != (lastBlock+1)/sectionSize {
+			t.Fatal("unexpected bloom status", size, sections)
+		}
+		heights, err := idx.matchingBlocks(
+			context.Background(),
+			0,
+			sections*size-1,
+			[][][]byte{{addr.Bytes()}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[uint64]bool)
+		for _, height := range heights {
+			found[height] = true
+		}
+		for height := range matchingHeights {
+			if height < sections*size && !found[height] {
+				t.Error("bloom index missed block", height)
+			}
+		}
+	}
+	checkMatches(idx)
+
+	// Restoring from the database should give the same result
+	latest := uint64(lastBlock)
+	restored := newBloomIndex(db, store.getHeader, sectionSize)
+	if err := restored.load(&latest); err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(restored)
+
+	// An index created over an existing chain should be backfilled
+	backfilled := newBloomIndex(rawdb.NewMemoryDatabase(), store.getHeader, sectionSize)
+	if err := backfilled.load(&latest); err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(backfilled)
+
+	// Rolling back should discard sections past the reorg height
+	if err := restored.reset(70); err != nil {
+		t.Fatal(err)
+	}
+	if _, sections := restored.status(); sections != 4 {
+		t.Error("unexpected section count after reorg", sections)
+	}
+
+	// Rolling back before the first block clears the index
+	if err := restored.reset(firstBlock - sectionSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, sections := restored.status(); sections != 0 {
+		t.Error("expected index to be cleared", sections)
+	}
+}
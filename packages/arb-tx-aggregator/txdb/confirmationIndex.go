@@ -0,0 +1,387 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+var (
+	loggedAssertionPrefix = []byte("loggedAssertion")
+	blockLogPrefix        = []byte("blockLog")
+)
+
+// AssertionStatus is the state of the rollup node created by an assertion
+type AssertionStatus uint8
+
+const (
+	// AssertionPending nodes haven't been confirmed or rejected yet
+	AssertionPending AssertionStatus = iota
+
+	// AssertionConfirmed nodes were confirmed
+	AssertionConfirmed
+
+	// AssertionRejected nodes are on a branch which conflicts with a
+	// confirmed node and can never be confirmed
+	AssertionRejected
+)
+
+// Assertion is a rollup assertion which emitted machine logs
+type Assertion struct {
+	BeforeLogCount uint64
+	AfterLogCount  uint64
+	LastLogHash    common.Hash
+	L1BlockNum     *big.Int
+	L1BlockHash    common.Hash
+
+	Status AssertionStatus
+	// StatusL1BlockNum is the L1 block in which the assertion was confirmed
+	// or rejected
+	StatusL1BlockNum uint64
+}
+
+// confirmationIndex follows assertions and confirmations of the rollup chain
+// to track how many of the machine's logs are covered by a pending or
+// confirmed node and by a confirmed node.
+//
+// Every assertion which emitted logs is stored keyed by its log count after
+// and its last log hash, so that the assertion which emitted a given log can
+// be found, along with the status of its node. Confirmed assertions are
+// identified by matching the logs accumulator in the ConfirmedAssertion event
+// against the last log hash of each pending assertion. Pending assertions
+// which don't start at the confirmed log count or at the end of another
+// pending assertion are on a branch that conflicts with the confirmed nodes,
+// so they are marked as rejected and no longer count as asserted. Events may
+// be added more than once without affecting the result.
+//
+// The L1 block of each assertion, confirmation and rejection is recorded so
+// that rollback can undo the events of blocks removed by a reorg. The index
+// of each block's block log is recorded so that log counts can be converted
+// to the latest block they cover
+type confirmationIndex struct {
+	sync.Mutex
+	db ethdb.Database
+
+	// pending holds the assertions of pending nodes by key
+	pending   map[string]*Assertion
+	confirmed uint64
+}
+
+func newConfirmationIndex(db ethdb.Database) *confirmationIndex {
+	return &confirmationIndex{
+		db:      db,
+		pending: make(map[string]*Assertion),
+	}
+}
+
+func loggedAssertionKey(afterLogCount uint64, lastLogHash common.Hash) []byte {
+	key := append(append([]byte{}, loggedAssertionPrefix...), encodeUint64(afterLogCount)...)
+	return append(key, lastLogHash.Bytes()...)
+}
+
+// blockLogKey orders keys by decreasing log index so that iteration finds the
+// latest block first
+func blockLogKey(logIndex uint64) []byte {
+	return append(append([]byte{}, blockLogPrefix...), encodeUint64(math.MaxUint64-logIndex)...)
+}
+
+func eventBlockNum(info arbbridge.ChainInfo) uint64 {
+	if info.BlockId == nil {
+		return 0
+	}
+	return info.BlockId.Height.AsInt().Uint64()
+}
+
+func (idx *confirmationIndex) load() error {
+	idx.Lock()
+	defer idx.Unlock()
+	return idx.loadLocked()
+}
+
+func (idx *confirmationIndex) loadLocked() error {
+	pending := make(map[string]*Assertion)
+	confirmed := uint64(0)
+	it := idx.db.NewIterator(loggedAssertionPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		assertion := new(Assertion)
+		if err := rlp.DecodeBytes(it.Value(), assertion); err != nil {
+			return err
+		}
+		switch assertion.Status {
+		case AssertionPending:
+			pending[string(it.Key())] = assertion
+		case AssertionConfirmed:
+			if assertion.AfterLogCount > confirmed {
+				confirmed = assertion.AfterLogCount
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	idx.pending = pending
+	idx.confirmed = confirmed
+	return nil
+}
+
+func (idx *confirmationIndex) addEvents(events []arbbridge.Event) error {
+	idx.Lock()
+	defer idx.Unlock()
+	pending := make(map[string]*Assertion, len(idx.pending))
+	for key, assertion := range idx.pending {
+		pending[key] = assertion
+	}
+	confirmed := idx.confirmed
+	// Assertions which were added or whose status changed
+	updated := make(map[string]*Assertion)
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case arbbridge.AssertedEvent:
+			if ev.LogCount == 0 || ev.BeforeLogCount == nil {
+				// Assertions without logs don't move either count
+				continue
+			}
+			assertion := &Assertion{
+				BeforeLogCount: ev.BeforeLogCount.Uint64(),
+				AfterLogCount:  ev.BeforeLogCount.Uint64() + ev.LogCount,
+				LastLogHash:    ev.LastLogHash,
+			}
+			if ev.BlockId != nil {
+				assertion.L1BlockNum = ev.BlockId.Height.AsInt()
+				assertion.L1BlockHash = ev.BlockId.HeaderHash
+			}
+			key := loggedAssertionKey(assertion.AfterLogCount, assertion.LastLogHash)
+			if _, ok := updated[string(key)]; ok {
+				continue
+			}
+			if _, ok := pending[string(key)]; ok {
+				continue
+			}
+			// Assertions which were already confirmed or rejected are known
+			known, err := idx.db.Has(key)
+			if err != nil {
+				return err
+			}
+			if known || !extendsLiveNode(pending, confirmed, assertion.BeforeLogCount) {
+				continue
+			}
+			pending[string(key)] = assertion
+			updated[string(key)] = assertion
+		case arbbridge.ConfirmedAssertionEvent:
+			blockNum := eventBlockNum(ev.ChainInfo)
+			for _, logsAcc := range ev.LogsAccHash {
+				if logsAcc == (common.Hash{}) {
+					continue
+				}
+				key, assertion := findPendingAssertion(pending, logsAcc, confirmed)
+				if assertion == nil {
+					continue
+				}
+				confirmedAssertion := *assertion
+				confirmedAssertion.Status = AssertionConfirmed
+				confirmedAssertion.StatusL1BlockNum = blockNum
+				delete(pending, key)
+				updated[key] = &confirmedAssertion
+				if assertion.AfterLogCount > confirmed {
+					confirmed = assertion.AfterLogCount
+				}
+			}
+			// Rejecting a node also rejects the nodes built on top of it
+			for rejected := true; rejected; {
+				rejected = false
+				for key, assertion := range pending {
+					if extendsLiveNode(pending, confirmed, assertion.BeforeLogCount) {
+						continue
+					}
+					rejectedAssertion := *assertion
+					rejectedAssertion.Status = AssertionRejected
+					rejectedAssertion.StatusL1BlockNum = blockNum
+					delete(pending, key)
+					updated[key] = &rejectedAssertion
+					rejected = true
+				}
+			}
+		}
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	batch := idx.db.NewBatch()
+	for key, assertion := range updated {
+		data, err := rlp.EncodeToBytes(assertion)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put([]byte(key), data); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	idx.pending = pending
+	idx.confirmed = confirmed
+	return nil
+}
+
+// extendsLiveNode returns true if an assertion starting at beforeLogCount
+// builds on the latest confirmed node or on a pending node. Otherwise it
+// builds on a rejected branch
+func extendsLiveNode(pending map[string]*Assertion, confirmed uint64, beforeLogCount uint64) bool {
+	if beforeLogCount == confirmed {
+		return true
+	}
+	if beforeLogCount < confirmed {
+		return false
+	}
+	for _, assertion := range pending {
+		if assertion.AfterLogCount == beforeLogCount {
+			return true
+		}
+	}
+	return false
+}
+
+// findPendingAssertion returns the pending assertion with the given last log
+// hash which extends the confirmed logs. If there are several, the one with
+// the fewest logs is chosen
+func findPendingAssertion(pending map[string]*Assertion, lastLogHash common.Hash, confirmed uint64) (string, *Assertion) {
+	var foundKey string
+	var found *Assertion
+	for key, assertion := range pending {
+		if assertion.LastLogHash != lastLogHash || assertion.BeforeLogCount < confirmed {
+			continue
+		}
+		if found == nil || assertion.AfterLogCount < found.AfterLogCount {
+			foundKey, found = key, assertion
+		}
+	}
+	return foundKey, found
+}
+
+// rollback undoes the effects of events from L1 blocks after height. It's
+// called when the observer restarts from an earlier block, after which those
+// events are added again
+func (idx *confirmationIndex) rollback(height uint64) error {
+	idx.Lock()
+	defer idx.Unlock()
+	batch := idx.db.NewBatch()
+	if err := func() error {
+		it := idx.db.NewIterator(loggedAssertionPrefix, nil)
+		defer it.Release()
+		for it.Next() {
+			key := append([]byte{}, it.Key()...)
+			assertion := new(Assertion)
+			if err := rlp.DecodeBytes(it.Value(), assertion); err != nil {
+				return err
+			}
+			if assertion.L1BlockNum != nil && assertion.L1BlockNum.Uint64() > height {
+				if err := batch.Delete(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if assertion.Status != AssertionPending && assertion.StatusL1BlockNum > height {
+				assertion.Status = AssertionPending
+				assertion.StatusL1BlockNum = 0
+				data, err := rlp.EncodeToBytes(assertion)
+				if err != nil {
+					return err
+				}
+				if err := batch.Put(key, data); err != nil {
+					return err
+				}
+			}
+		}
+		return it.Error()
+	}(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	return idx.loadLocked()
+}
+
+// assertionForLog returns the assertion which emitted the log with the given
+// index, or nil if it hasn't been asserted by a node that wasn't rejected
+func (idx *confirmationIndex) assertionForLog(logIndex uint64) (*Assertion, error) {
+	it := idx.db.NewIterator(loggedAssertionPrefix, encodeUint64(logIndex+1))
+	defer it.Release()
+	for it.Next() {
+		assertion := new(Assertion)
+		if err := rlp.DecodeBytes(it.Value(), assertion); err != nil {
+			return nil, err
+		}
+		if assertion.Status == AssertionRejected || assertion.BeforeLogCount > logIndex {
+			continue
+		}
+		return assertion, nil
+	}
+	return nil, it.Error()
+}
+
+func (idx *confirmationIndex) addBlockLog(logIndex uint64, height uint64) error {
+	return idx.db.Put(blockLogKey(logIndex), encodeUint64(height))
+}
+
+// latestBlockBefore returns the height of the latest block whose block log
+// comes before logCount, or nil if there is none. Entries which valid
+// rejects, such as blocks removed by a reorg, are skipped
+func (idx *confirmationIndex) latestBlockBefore(logCount uint64, valid func(logIndex, height uint64) (bool, error)) (*uint64, error) {
+	if logCount == 0 {
+		return nil, nil
+	}
+	it := idx.db.NewIterator(blockLogPrefix, encodeUint64(math.MaxUint64-(logCount-1)))
+	defer it.Release()
+	for it.Next() {
+		logIndex := math.MaxUint64 - binary.BigEndian.Uint64(it.Key()[len(blockLogPrefix):])
+		height := binary.BigEndian.Uint64(it.Value())
+		ok, err := valid(logIndex, height)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &height, nil
+		}
+	}
+	return nil, it.Error()
+}
+
+// counts returns the number of logs covered by pending or confirmed nodes and
+// by confirmed nodes
+func (idx *confirmationIndex) counts() (uint64, uint64) {
+	idx.Lock()
+	defer idx.Unlock()
+	asserted := idx.confirmed
+	for _, assertion := range idx.pending {
+		if assertion.AfterLogCount > asserted {
+			asserted = assertion.AfterLogCount
+		}
+	}
+	return asserted, idx.confirmed
+}
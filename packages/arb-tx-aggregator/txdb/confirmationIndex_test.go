@@ -0,0 +1,309 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+func TestConfirmationIndex(t *testing.T) {
+	assertion := func(lastLogHash common.Hash, before, count uint64) arbbridge.AssertedEvent {
+		return arbbridge.AssertedEvent{
+			LastLogHash:    lastLogHash,
+			LogCount:       count,
+			BeforeLogCount: new(big.Int).SetUint64(before),
+		}
+	}
+	checkCounts := func(idx *confirmationIndex, asserted, confirmed uint64) {
+		t.Helper()
+		a, c := idx.counts()
+		if a != asserted || c != confirmed {
+			t.Fatal("unexpected counts", a, c, "expected", asserted, confirmed)
+		}
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	idx := newConfirmationIndex(db)
+	if err := idx.load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 0, 0)
+
+	first := assertion(common.Hash{1}, 0, 5)
+	empty := arbbridge.AssertedEvent{BeforeLogCount: big.NewInt(5)}
+	second := assertion(common.Hash{2}, 5, 3)
+	events := []arbbridge.Event{first, empty, second}
+	if err := idx.addEvents(events); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 8, 0)
+
+	// Adding the same events again must not change anything
+	if err := idx.addEvents(events); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 8, 0)
+
+	confirm := arbbridge.ConfirmedAssertionEvent{
+		LogsAccHash: []common.Hash{{}, {1}},
+	}
+	if err := idx.addEvents([]arbbridge.Event{confirm}); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 8, 5)
+
+	// The index must survive a restart
+	reloaded := newConfirmationIndex(db)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(reloaded, 8, 5)
+
+	// Confirmation of an assertion from the same batch of events
+	third := assertion(common.Hash{3}, 8, 2)
+	confirm = arbbridge.ConfirmedAssertionEvent{
+		LogsAccHash: []common.Hash{{2}, {3}},
+	}
+	if err := reloaded.addEvents([]arbbridge.Event{third, confirm}); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(reloaded, 10, 10)
+
+	// Replaying the first confirmation doesn't move the count backwards
+	confirm = arbbridge.ConfirmedAssertionEvent{
+		LogsAccHash: []common.Hash{{1}},
+	}
+	if err := reloaded.addEvents([]arbbridge.Event{first, confirm}); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(reloaded, 10, 10)
+
+	for logIndex, expected := range map[uint64]*common.Hash{
+		0:  {1},
+		4:  {1},
+		5:  {2},
+		7:  {2},
+		9:  {3},
+		10: nil,
+	} {
+		assertion, err := reloaded.assertionForLog(logIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			if assertion != nil {
+				t.Error("log", logIndex, "shouldn't be asserted")
+			}
+			continue
+		}
+		if assertion == nil || assertion.LastLogHash != *expected {
+			t.Error("wrong assertion for log", logIndex, assertion)
+		}
+	}
+}
+
+func TestConfirmationIndexRejectedBranch(t *testing.T) {
+	idx := newConfirmationIndex(rawdb.NewMemoryDatabase())
+	first := arbbridge.AssertedEvent{
+		LastLogHash:    common.Hash{1},
+		LogCount:       5,
+		BeforeLogCount: big.NewInt(0),
+	}
+	// rival conflicts with first and covers more logs
+	rival := arbbridge.AssertedEvent{
+		LastLogHash:    common.Hash{9},
+		LogCount:       7,
+		BeforeLogCount: big.NewInt(0),
+	}
+	// extension builds on rival
+	extension := arbbridge.AssertedEvent{
+		LastLogHash:    common.Hash{10},
+		LogCount:       2,
+		BeforeLogCount: big.NewInt(7),
+	}
+	if err := idx.addEvents([]arbbridge.Event{first, rival, extension}); err != nil {
+		t.Fatal(err)
+	}
+	if asserted, _ := idx.counts(); asserted != 9 {
+		t.Fatal("wrong asserted count", asserted)
+	}
+
+	confirm := arbbridge.ConfirmedAssertionEvent{LogsAccHash: []common.Hash{{1}}}
+	if err := idx.addEvents([]arbbridge.Event{confirm}); err != nil {
+		t.Fatal(err)
+	}
+	if asserted, confirmed := idx.counts(); asserted != 5 || confirmed != 5 {
+		t.Fatal("rejected branch still counted", asserted, confirmed)
+	}
+
+	// Adding the rejected branch again doesn't bring it back
+	if err := idx.addEvents([]arbbridge.Event{rival, extension}); err != nil {
+		t.Fatal(err)
+	}
+	if asserted, _ := idx.counts(); asserted != 5 {
+		t.Fatal("rejected branch still counted", asserted)
+	}
+
+	assertion, err := idx.assertionForLog(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion != nil {
+		t.Error("log asserted by rejected node", assertion.LastLogHash)
+	}
+	assertion, err = idx.assertionForLog(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion == nil || assertion.LastLogHash != first.LastLogHash || assertion.Status != AssertionConfirmed {
+		t.Error("wrong assertion for log", assertion)
+	}
+}
+
+func TestConfirmationIndexRollback(t *testing.T) {
+	chainInfo := func(height int64) arbbridge.ChainInfo {
+		return arbbridge.ChainInfo{
+			BlockId: &common.BlockId{
+				Height:     common.NewTimeBlocksInt(height),
+				HeaderHash: common.Hash{byte(height)},
+			},
+		}
+	}
+	checkCounts := func(idx *confirmationIndex, asserted, confirmed uint64) {
+		t.Helper()
+		a, c := idx.counts()
+		if a != asserted || c != confirmed {
+			t.Fatal("unexpected counts", a, c, "expected", asserted, confirmed)
+		}
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	idx := newConfirmationIndex(db)
+	blocks := [][]arbbridge.Event{
+		{
+			arbbridge.AssertedEvent{
+				ChainInfo:      chainInfo(1),
+				LastLogHash:    common.Hash{1},
+				LogCount:       5,
+				BeforeLogCount: big.NewInt(0),
+			},
+		},
+		{
+			arbbridge.AssertedEvent{
+				ChainInfo:      chainInfo(2),
+				LastLogHash:    common.Hash{2},
+				LogCount:       3,
+				BeforeLogCount: big.NewInt(5),
+			},
+			arbbridge.AssertedEvent{
+				ChainInfo:      chainInfo(2),
+				LastLogHash:    common.Hash{9},
+				LogCount:       9,
+				BeforeLogCount: big.NewInt(0),
+			},
+		},
+		{
+			arbbridge.ConfirmedAssertionEvent{
+				ChainInfo:   chainInfo(3),
+				LogsAccHash: []common.Hash{{1}},
+			},
+		},
+	}
+	for _, events := range blocks {
+		if err := idx.addEvents(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCounts(idx, 8, 5)
+
+	// Removing the confirmation restores the rejected branch
+	if err := idx.rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 9, 0)
+
+	if err := idx.rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(idx, 5, 0)
+	assertion, err := idx.assertionForLog(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion != nil {
+		t.Error("log still asserted after rollback", assertion.LastLogHash)
+	}
+
+	// The rollback must survive a restart
+	reloaded := newConfirmationIndex(db)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(reloaded, 5, 0)
+
+	// Replaying the removed blocks gives the same result as before
+	for _, events := range blocks[1:] {
+		if err := reloaded.addEvents(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCounts(reloaded, 8, 5)
+}
+
+func TestLatestBlockBefore(t *testing.T) {
+	idx := newConfirmationIndex(rawdb.NewMemoryDatabase())
+	// Block 1's log was replaced by block 2 in a reorg
+	for _, block := range [][2]uint64{{0, 0}, {3, 1}, {3, 2}, {6, 3}, {9, 4}} {
+		if err := idx.addBlockLog(block[0], block[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed := uint64(4)
+	valid := func(logIndex, height uint64) (bool, error) {
+		return height != removed, nil
+	}
+
+	// -1 means that no block comes before the log count
+	for logCount, expected := range map[uint64]int64{
+		0:  -1,
+		1:  0,
+		3:  0,
+		4:  2,
+		9:  3,
+		20: 3,
+	} {
+		height, err := idx.latestBlockBefore(logCount, valid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected < 0 {
+			if height != nil {
+				t.Error("unexpected block before log count", logCount, *height)
+			}
+			continue
+		}
+		if height == nil || *height != uint64(expected) {
+			t.Error("wrong block before log count", logCount, height)
+		}
+	}
+}
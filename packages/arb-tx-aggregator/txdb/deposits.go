@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/event"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// IsDepositKind returns true for inbox messages which deposit ETH or tokens
+// from L1
+func IsDepositKind(kind inbox.Type) bool {
+	return kind == message.EthType || kind == message.ERC20Type || kind == message.ERC721Type
+}
+
+// Deposit is the L2 result of an ETH, ERC20 or ERC721 deposit
+type Deposit struct {
+	// Message is a message.Eth, message.ERC20 or message.ERC721
+	Message message.Message
+	Result  *evm.TxResult
+}
+
+// NewDeposit returns nil if the result isn't from a deposit message
+func NewDeposit(res *evm.TxResult) *Deposit {
+	if !IsDepositKind(res.IncomingRequest.Kind) {
+		return nil
+	}
+	msg, err := message.NestedMessage(res.IncomingRequest.Data, res.IncomingRequest.Kind)
+	if err != nil {
+		return nil
+	}
+	return &Deposit{Message: msg, Result: res}
+}
+
+func (d *Deposit) InboxSeqNum() *big.Int {
+	return d.Result.IncomingRequest.Provenance.L1SeqNum
+}
+
+// Dest is the L2 account credited by the deposit
+func (d *Deposit) Dest() common.Address {
+	return TransferDest(d.Message)
+}
+
+// Credited returns true if the deposit succeeded on L2
+func (d *Deposit) Credited() bool {
+	return d.Result.ResultCode == evm.ReturnCode
+}
+
+// GetDeposit returns nil if the inbox message isn't a deposit that has been
+// processed
+func (txdb *View) GetDeposit(seqNum *big.Int) (*Deposit, error) {
+	requestIds, err := txdb.GetInboxMessageRequests(seqNum)
+	if err != nil {
+		return nil, err
+	}
+	for _, requestId := range requestIds {
+		logVal, err := txdb.GetRequest(requestId)
+		if err != nil {
+			return nil, err
+		}
+		if logVal == nil {
+			continue
+		}
+		res, err := evm.NewTxResultFromValue(logVal)
+		if err != nil {
+			return nil, err
+		}
+		if deposit := NewDeposit(res); deposit != nil {
+			return deposit, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *TxDB) sendDeposits(results []*evm.TxResult) {
+	var deposits []*Deposit
+	for _, res := range results {
+		if deposit := NewDeposit(res); deposit != nil {
+			deposits = append(deposits, deposit)
+		}
+	}
+	if len(deposits) > 0 {
+		db.depositFeed.Send(deposits)
+	}
+}
+
+// SubscribeDepositEvent notifies the subscriber of deposits as their results
+// are added to the chain
+func (db *TxDB) SubscribeDepositEvent(ch chan<- []*Deposit) event.Subscription {
+	return db.depositFeed.Subscribe(ch)
+}
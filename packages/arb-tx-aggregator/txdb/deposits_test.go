@@ -0,0 +1,74 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func TestNewDeposit(t *testing.T) {
+	result := func(msg message.Message, code evm.ResultType) *evm.TxResult {
+		return &evm.TxResult{
+			IncomingRequest: evm.IncomingRequest{
+				Kind:       msg.Type(),
+				Data:       msg.AsData(),
+				Provenance: evm.Provenance{L1SeqNum: big.NewInt(4)},
+			},
+			ResultCode: code,
+		}
+	}
+
+	dest := common.Address{7}
+	deposits := []message.Message{
+		message.Eth{Dest: dest, Value: big.NewInt(100)},
+		message.ERC20{Token: common.Address{1}, Dest: dest, Value: big.NewInt(200)},
+		message.ERC721{Token: common.Address{2}, Dest: dest, ID: big.NewInt(300)},
+	}
+	for _, msg := range deposits {
+		deposit := NewDeposit(result(msg, evm.ReturnCode))
+		if deposit == nil {
+			t.Fatal("failed to parse deposit", msg)
+		}
+		if deposit.Dest() != dest {
+			t.Error("wrong dest", deposit.Dest())
+		}
+		if !deposit.Credited() {
+			t.Error("deposit should be credited")
+		}
+		if deposit.InboxSeqNum().Int64() != 4 {
+			t.Error("wrong inbox seq num", deposit.InboxSeqNum())
+		}
+		if deposit.Message.Type() != msg.Type() || !bytes.Equal(deposit.Message.AsData(), msg.AsData()) {
+			t.Error("wrong message", deposit.Message)
+		}
+	}
+
+	failed := NewDeposit(result(deposits[0], evm.RevertCode))
+	if failed == nil || failed.Credited() {
+		t.Error("failed deposit shouldn't be credited")
+	}
+
+	if NewDeposit(result(message.L2Message{Data: []byte{1}}, evm.ReturnCode)) != nil {
+		t.Error("parsed L2 message as deposit")
+	}
+}
@@ -60,15 +60,7 @@ func (sc *snapshotCache) getSnapshot(time inbox.ChainTime) *snapshot.Snapshot {
 		return nil
 	}
 
-	snap := nearest.Value.(*snapshot.Snapshot)
-	if snap.Height().Cmp(time.BlockNum) == 0 {
-		return snap
-	}
-
-	// advance time on found snapshot
-	snap = snap.Clone()
-	snap.AdvanceTime(time)
-	return snap
+	return advanceSnapshot(nearest.Value.(*snapshot.Snapshot), time)
 }
 
 func (sc *snapshotCache) addSnapshot(snap *snapshot.Snapshot) {
@@ -77,3 +69,14 @@ func (sc *snapshotCache) addSnapshot(snap *snapshot.Snapshot) {
 		sc.tree.Remove(sc.tree.Left().Key)
 	}
 }
+
+// advanceSnapshot returns a snapshot at the given time from one at or
+// before it
+func advanceSnapshot(snap *snapshot.Snapshot, time inbox.ChainTime) *snapshot.Snapshot {
+	if snap.Height().Cmp(time.BlockNum) == 0 {
+		return snap
+	}
+	snap = snap.Clone()
+	snap.AdvanceTime(time)
+	return snap
+}
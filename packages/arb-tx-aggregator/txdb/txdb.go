@@ -22,7 +22,9 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/trie"
 	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
@@ -44,6 +46,8 @@ import (
 
 var snapshotCacheSize = 100
 
+var blockResultsCacheSize = 100
+
 type TxDB struct {
 	View
 	mach         machine.Machine
@@ -58,38 +62,88 @@ type TxDB struct {
 	logsFeed        event.Feed
 	pendingLogsFeed event.Feed
 	blockProcFeed   event.Feed
+	depositFeed     event.Feed
 
 	callMut            sync.Mutex
 	lastBlockProcessed *common.BlockId
 	lastInboxSeq       *big.Int
 	snapCache          *snapshotCache
+	blockResults       *blockResultsCache
+
+	confirmations *confirmationIndex
+	withdrawals   *withdrawalIndex
+
+	// archive is nil unless archive mode is enabled
+	archive *archive
+
+	// addresses is nil unless the address index is enabled
+	addresses *addressIndex
 }
 
 func New(
 	clnt arbbridge.ChainTimeGetter,
 	checkpointer checkpointing.RollupCheckpointer,
 	as *cmachine.AggregatorStore,
+	indexDB ethdb.Database,
 	chain common.Address,
+	archiveConfig *ArchiveConfig,
+	indexAddresses bool,
 ) *TxDB {
+	bloom := newBloomIndex(indexDB, func(height uint64) (*types.Header, error) {
+		info, err := as.GetBlock(height)
+		if err != nil || info == nil {
+			return nil, err
+		}
+		return info.Header, nil
+	}, bloomSectionSize)
+	var archive *archive
+	if archiveConfig != nil {
+		archive = newArchive(indexDB, archiveConfig.CacheSize)
+	}
+	var addresses *addressIndex
+	if indexAddresses {
+		addresses = newAddressIndex(indexDB)
+	}
 	return &TxDB{
-		View:         View{as: as},
-		checkpointer: checkpointer,
-		timeGetter:   clnt,
-		chain:        chain,
-		snapCache:    newSnapshotCache(snapshotCacheSize),
+		View:          View{as: as, bloom: bloom, batches: newBatchIndex(indexDB)},
+		checkpointer:  checkpointer,
+		timeGetter:    clnt,
+		chain:         chain,
+		snapCache:     newSnapshotCache(snapshotCacheSize),
+		blockResults:  newBlockResultsCache(blockResultsCacheSize),
+		confirmations: newConfirmationIndex(indexDB),
+		withdrawals:   newWithdrawalIndex(indexDB),
+		archive:       archive,
+		addresses:     addresses,
 	}
 }
 
 func (db *TxDB) Load(ctx context.Context) error {
+	if err := db.confirmations.load(); err != nil {
+		return err
+	}
 	if db.checkpointer.HasCheckpointedState() {
 		err := db.restoreFromCheckpoint(ctx)
 		if err == nil {
-			return nil
+			return db.loadBloomIndex()
 		}
 		log.Println("Error restoring from checkpoint:", err)
 		log.Println("Failed to restore from checkpoint, falling back to fresh start")
 	}
 	// We failed to restore from a checkpoint
+	if db.archive != nil {
+		if err := db.archive.removeBatchesFrom(0); err != nil {
+			return err
+		}
+	}
+	if db.addresses != nil {
+		if err := db.addresses.rollback(0); err != nil {
+			return err
+		}
+	}
+	if err := db.confirmations.rollback(0); err != nil {
+		return err
+	}
 	valueCache, err := cmachine.NewValueCache()
 	if err != nil {
 		return err
@@ -105,7 +159,17 @@ func (db *TxDB) Load(ctx context.Context) error {
 	defer db.callMut.Unlock()
 	db.lastBlockProcessed = nil
 	db.lastInboxSeq = big.NewInt(0)
-	return nil
+	return db.loadBloomIndex()
+}
+
+func (db *TxDB) loadBloomIndex() error {
+	latest, err := db.as.LatestBlock()
+	if err != nil {
+		// No blocks have been saved yet
+		return db.bloom.load(nil)
+	}
+	height := latest.Height.AsInt().Uint64()
+	return db.bloom.load(&height)
 }
 
 func (db *TxDB) AddInitialBlock(ctx context.Context, initialBlockHeight *big.Int) error {
@@ -127,11 +191,8 @@ func (db *TxDB) restoreFromCheckpoint(ctx context.Context) error {
 	var blockId *common.BlockId
 	var lastInboxSeq *big.Int
 	if err := db.checkpointer.RestoreLatestState(ctx, db.timeGetter, func(chainObserverBytes []byte, restoreCtx ckptcontext.RestoreContext, restoreBlockId *common.BlockId) error {
-		var machineHash common.Hash
-		copy(machineHash[:], chainObserverBytes)
-		lastInboxSeq = new(big.Int).SetBytes(chainObserverBytes[32:])
 		var err error
-		mach, err = restoreCtx.GetMachine(machineHash)
+		mach, lastInboxSeq, err = unmarshalCheckpoint(chainObserverBytes, restoreCtx)
 		if err != nil {
 			return err
 		}
@@ -141,6 +202,12 @@ func (db *TxDB) restoreFromCheckpoint(ctx context.Context) error {
 		return err
 	}
 
+	if db.archive != nil {
+		if err := db.archive.removeBatchesFrom(blockId.Height.AsInt().Uint64() + 1); err != nil {
+			return err
+		}
+	}
+
 	restoreHeight := blockId.Height.AsInt().Uint64()
 	// Find the previous block checkout that included an AVM log to find the max
 	// avm log and avm send index at restore point
@@ -198,6 +265,18 @@ func (db *TxDB) restoreFromCheckpoint(ctx context.Context) error {
 		}
 	}
 
+	if db.addresses != nil {
+		if err := db.addresses.rollback(block.ChainStats.AVMLogCount.Uint64()); err != nil {
+			return err
+		}
+	}
+
+	// Rollup events after the checkpoint are added again as the observer
+	// catches up, and may have been removed by an L1 reorg
+	if err := db.confirmations.rollback(blockId.Height.AsInt().Uint64()); err != nil {
+		return err
+	}
+
 	if err := db.as.Reorg(
 		blockId.Height.AsInt().Uint64(),
 		block.ChainStats.AVMSendCount.Uint64(),
@@ -215,6 +294,61 @@ func (db *TxDB) restoreFromCheckpoint(ctx context.Context) error {
 	return nil
 }
 
+// unmarshalCheckpoint returns the machine and last inbox sequence number
+// saved by AddMessages
+func unmarshalCheckpoint(chainObserverBytes []byte, restoreCtx ckptcontext.RestoreContext) (machine.Machine, *big.Int, error) {
+	var machineHash common.Hash
+	copy(machineHash[:], chainObserverBytes)
+	lastInboxSeq := new(big.Int).SetBytes(chainObserverBytes[32:])
+	mach, err := restoreCtx.GetMachine(machineHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mach, lastInboxSeq, nil
+}
+
+// AddRollupEvents records the assertions and confirmations of the rollup
+// chain. It must be called with the events of each L1 block before the block's
+// messages are added
+func (db *TxDB) AddRollupEvents(events []arbbridge.Event) error {
+	return db.confirmations.addEvents(events)
+}
+
+// LogConfirmationCounts returns the number of machine logs covered by pending
+// or confirmed nodes and by confirmed nodes
+func (db *TxDB) LogConfirmationCounts() (uint64, uint64) {
+	return db.confirmations.counts()
+}
+
+// SafeBlock returns the height of the latest block covered by a pending or
+// confirmed node, or nil if no blocks have been asserted. Nodes on branches
+// rejected by a confirmation don't count
+func (db *TxDB) SafeBlock() (*uint64, error) {
+	asserted, _ := db.confirmations.counts()
+	return db.latestBlockBefore(asserted)
+}
+
+// FinalizedBlock returns the height of the latest block covered by a
+// confirmed node, or nil if no blocks have been confirmed
+func (db *TxDB) FinalizedBlock() (*uint64, error) {
+	_, confirmed := db.confirmations.counts()
+	return db.latestBlockBefore(confirmed)
+}
+
+func (db *TxDB) latestBlockBefore(logCount uint64) (*uint64, error) {
+	return db.confirmations.latestBlockBefore(logCount, func(logIndex, height uint64) (bool, error) {
+		info, err := db.GetBlock(height)
+		if err != nil || info == nil || info.BlockLog == nil {
+			return false, err
+		}
+		block, err := evm.NewBlockResultFromValue(info.BlockLog)
+		if err != nil {
+			return false, err
+		}
+		return block.LastAVMLog().Uint64() == logIndex, nil
+	})
+}
+
 func (db *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliveredEvent, finishedBlock *common.BlockId) error {
 	timestamp, err := db.timeGetter.TimestampForBlockHash(ctx, finishedBlock.HeaderHash)
 	db.blockProcFeed.Send(true)
@@ -224,6 +358,16 @@ func (db *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliver
 		return err
 	}
 
+	if err := db.batches.addMessages(msgs); err != nil {
+		return err
+	}
+
+	if db.archive != nil {
+		if err := db.archive.addBatch(msgs, finishedBlock.Height.AsInt().Uint64(), timestamp); err != nil {
+			return err
+		}
+	}
+
 	var lastBlock *evm.BlockInfo
 	for _, msg := range msgs {
 		// TODO: Give ExecuteAssertion the ability to run unbounded until it blocks
@@ -348,6 +492,9 @@ func (db *TxDB) saveEmptyBlock(ctx context.Context, prev ethcommon.Hash, number
 	if err := db.as.SaveEmptyBlock(block.Header()); err != nil {
 		return err
 	}
+	if err := db.bloom.addHeader(block.Header()); err != nil {
+		return err
+	}
 
 	return db.as.SaveBlockHash(common.NewHashFromEth(block.Hash()), block.NumberU64())
 }
@@ -393,17 +540,22 @@ func (db *TxDB) GetBlockResults(res *evm.BlockInfo) ([]*evm.TxResult, error) {
 	return results, nil
 }
 
+// GetMachineBlockResults returns the decoded results of the transactions in
+// the block. The results are cached and shared between callers so they must
+// not be modified
 func (db *TxDB) GetMachineBlockResults(block *machine.BlockInfo) ([]*evm.TxResult, error) {
 	if block.BlockLog == nil {
 		// No arb block at this height
 		return nil, nil
 	}
 
-	res, err := evm.NewBlockResultFromValue(block.BlockLog)
-	if err != nil {
-		return nil, err
-	}
-	return db.GetBlockResults(res)
+	return db.blockResults.getOrDecode(block.Header.Hash(), func() ([]*evm.TxResult, error) {
+		res, err := evm.NewBlockResultFromValue(block.BlockLog)
+		if err != nil {
+			return nil, err
+		}
+		return db.GetBlockResults(res)
+	})
 }
 
 func (db *TxDB) GetReceipts(_ context.Context, blockHash ethcommon.Hash) (types.Receipts, error) {
@@ -500,6 +652,12 @@ func (db *TxDB) saveAssertion(ctx context.Context, processed processedAssertion)
 		if err := db.as.SaveBlock(block.Header(), avmLogIndex); err != nil {
 			return err
 		}
+		if err := db.confirmations.addBlockLog(avmLogIndex, info.BlockNum.Uint64()); err != nil {
+			return err
+		}
+		if err := db.bloom.addHeader(block.Header()); err != nil {
+			return err
+		}
 
 		ethLogs := make([]*types.Log, 0)
 		for _, res := range processedResults {
@@ -513,6 +671,18 @@ func (db *TxDB) saveAssertion(ctx context.Context, processed processedAssertion)
 			db.logsFeed.Send(ethLogs)
 		}
 
+		if err := db.batches.addRequests(startLog, txResults); err != nil {
+			return err
+		}
+		if err := db.indexWithdrawals(info, startLog, txResults); err != nil {
+			return err
+		}
+		if db.addresses != nil {
+			if err := db.addresses.addResults(startLog, txResults); err != nil {
+				return err
+			}
+		}
+
 		for i, txRes := range txResults {
 			if txRes.ResultCode == evm.BadSequenceCode {
 				// If this log failed with incorrect sequence number, only save the request if it hasn't been saved before
@@ -529,6 +699,7 @@ func (db *TxDB) saveAssertion(ctx context.Context, processed processedAssertion)
 		if err := db.as.SaveBlockHash(common.NewHashFromEth(block.Hash()), block.Number().Uint64()); err != nil {
 			return err
 		}
+		db.sendDeposits(txResults)
 	}
 	return nil
 }
@@ -563,10 +734,18 @@ func (db *TxDB) LatestSnapshot() *snapshot.Snapshot {
 	return db.snapCache.latest()
 }
 
-func (db *TxDB) GetSnapshot(time inbox.ChainTime) *snapshot.Snapshot {
+// GetSnapshot returns nil if the time is after the latest snapshot. If the
+// snapshot is no longer cached, it is nil unless archive mode is enabled, in
+// which case it is rebuilt
+func (db *TxDB) GetSnapshot(time inbox.ChainTime) (*snapshot.Snapshot, error) {
 	db.callMut.Lock()
-	defer db.callMut.Unlock()
-	return db.snapCache.getSnapshot(time)
+	snap := db.snapCache.getSnapshot(time)
+	latest := db.snapCache.latest()
+	db.callMut.Unlock()
+	if snap != nil || db.archive == nil || latest.Height().Cmp(time.BlockNum) < 0 {
+		return snap, nil
+	}
+	return db.rebuildSnapshot(context.Background(), time)
 }
 
 func (db *TxDB) LatestBlockId() *common.BlockId {
@@ -575,6 +754,14 @@ func (db *TxDB) LatestBlockId() *common.BlockId {
 	return db.lastBlockProcessed
 }
 
+func (db *TxDB) BloomStatus() (uint64, uint64) {
+	return db.bloom.status()
+}
+
+func (db *TxDB) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	db.bloom.serviceFilter(ctx, session)
+}
+
 func (db *TxDB) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return db.chainFeed.Subscribe(ch)
 }
@@ -595,6 +782,26 @@ func (db *TxDB) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return db.logsFeed.Subscribe(ch)
 }
 
+// SendPendingLogs notifies pending log subscribers of logs emitted by
+// transactions that have been executed speculatively but not yet included in
+// a block
+func (db *TxDB) SendPendingLogs(logs []*types.Log) {
+	db.pendingLogsFeed.Send(logs)
+}
+
+// RemovePendingLogs notifies pending log subscribers that logs sent with
+// SendPendingLogs were discarded because the transactions that emitted them
+// were requeued. The logs are sent again with Removed set
+func (db *TxDB) RemovePendingLogs(logs []*types.Log) {
+	removed := make([]*types.Log, 0, len(logs))
+	for _, l := range logs {
+		removedLog := *l
+		removedLog.Removed = true
+		removed = append(removed, &removedLog)
+	}
+	db.pendingLogsFeed.Send(removed)
+}
+
 func (db *TxDB) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return db.pendingLogsFeed.Subscribe(ch)
 }
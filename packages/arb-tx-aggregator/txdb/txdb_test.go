@@ -0,0 +1,75 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestPendingLogs(t *testing.T) {
+	db := &TxDB{}
+	ch := make(chan []*types.Log, 2)
+	sub := db.SubscribePendingLogsEvent(ch)
+	defer sub.Unsubscribe()
+
+	receive := func() []*types.Log {
+		t.Helper()
+		select {
+		case logs := <-ch:
+			return logs
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for pending logs")
+			return nil
+		}
+	}
+
+	logs := []*types.Log{
+		{Address: ethcommon.Address{1}, TxHash: ethcommon.Hash{2}, Index: 0},
+		{Address: ethcommon.Address{1}, TxHash: ethcommon.Hash{3}, Index: 1},
+	}
+	db.SendPendingLogs(logs)
+	sent := receive()
+	if len(sent) != len(logs) {
+		t.Fatal("unexpected pending log count", len(sent))
+	}
+	for _, pendingLog := range sent {
+		if pendingLog.Removed {
+			t.Error("new pending log marked as removed")
+		}
+	}
+
+	db.RemovePendingLogs(logs)
+	removed := receive()
+	if len(removed) != len(logs) {
+		t.Fatal("unexpected removed log count", len(removed))
+	}
+	for i, removedLog := range removed {
+		if !removedLog.Removed {
+			t.Error("removed log", i, "not marked as removed")
+		}
+		if removedLog.TxHash != logs[i].TxHash || removedLog.Index != logs[i].Index {
+			t.Error("removed log", i, "doesn't match pending log")
+		}
+		if logs[i].Removed {
+			t.Error("removing logs modified the original logs")
+		}
+	}
+}
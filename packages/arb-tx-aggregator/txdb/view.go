@@ -19,6 +19,8 @@ package txdb
 import (
 	"context"
 	"errors"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
@@ -28,7 +30,9 @@ import (
 )
 
 type View struct {
-	as *cmachine.AggregatorStore
+	as      *cmachine.AggregatorStore
+	bloom   *bloomIndex
+	batches *batchIndex
 }
 
 func (txdb *View) GetMessage(index uint64) (value.Value, error) {
@@ -40,22 +44,65 @@ func (txdb *View) GetLog(index uint64) (value.Value, error) {
 }
 
 func (txdb *View) GetRequest(requestId common.Hash) (value.Value, error) {
+	logVal, _, err := txdb.GetRequestWithIndex(requestId)
+	return logVal, err
+}
+
+// GetRequestWithIndex returns the result of the request along with the index
+// of the log containing it, or nil if the request hasn't been processed
+func (txdb *View) GetRequestWithIndex(requestId common.Hash) (value.Value, *uint64, error) {
 	requestCandidate := txdb.as.GetPossibleRequestInfo(requestId)
 	if requestCandidate == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 	logVal, err := txdb.as.GetLog(*requestCandidate)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	res, err := evm.NewTxResultFromValue(logVal)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if res.IncomingRequest.MessageID != requestId {
-		return nil, nil
+		return nil, nil, nil
 	}
-	return logVal, nil
+	return logVal, requestCandidate, nil
+}
+
+// GetInboxMessageOrigin returns nil if the L1 transaction which delivered the
+// inbox message isn't known
+func (txdb *View) GetInboxMessageOrigin(seqNum *big.Int) (*InboxMessageOrigin, error) {
+	return txdb.batches.origin(seqNum)
+}
+
+// GetInboxSeqNumsForL1Tx returns the sequence numbers of the inbox messages
+// delivered by an L1 transaction
+func (txdb *View) GetInboxSeqNumsForL1Tx(txHash common.Hash) ([]*big.Int, error) {
+	return txdb.batches.messagesInL1Tx(txHash)
+}
+
+// GetInboxMessageRequests returns the ids of the requests currently in the
+// chain which resulted from executing an inbox message, in the order they were
+// executed
+func (txdb *View) GetInboxMessageRequests(seqNum *big.Int) ([]common.Hash, error) {
+	requests, err := txdb.batches.requests(seqNum)
+	if err != nil {
+		return nil, err
+	}
+	requestIds := make([]common.Hash, 0, len(requests))
+	for _, req := range requests {
+		// Skip requests that were removed by a reorg or superseded by a later
+		// request with the same id
+		logVal, logIndex, err := txdb.GetRequestWithIndex(req.requestId)
+		if err != nil {
+			return nil, err
+		}
+		if logVal == nil || *logIndex != req.logIndex {
+			continue
+		}
+		requestIds = append(requestIds, req.requestId)
+	}
+	return requestIds, nil
 }
 
 func (txdb *View) GetBlockWithHash(blockHash common.Hash) (*machine.BlockInfo, error) {
@@ -109,62 +156,124 @@ func (txdb *View) FindLogs(
 		return logs, nil
 	}
 
-	for i := startHeight; i <= endHeight; i++ {
+	// Use the bloom index for the range it covers and fall back to checking
+	// the bloom of each block for the remainder
+	filters := logQueryFilters(address, topics)
+	sectionSize, sections := txdb.bloom.status()
+	indexedEnd := sectionSize * sections
+	if len(filters) > 0 && startHeight < indexedEnd {
+		matchEnd := endHeight
+		if matchEnd > indexedEnd {
+			matchEnd = indexedEnd
+		}
+		heights, err := txdb.bloom.matchingBlocks(ctx, startHeight, matchEnd-1, filters)
+		if err != nil {
+			return nil, err
+		}
+		for _, height := range heights {
+			blockLogs, err := txdb.blockLogs(height, address, topics)
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, blockLogs...)
+		}
+		startHeight = matchEnd
+	}
+
+	for i := startHeight; i < endHeight; i++ {
 		select {
 		case <-ctx.Done():
 			return nil, errors.New("call timed out")
 		default:
 		}
-		blockInfo, err := txdb.GetBlock(i)
+		blockLogs, err := txdb.blockLogs(i, address, topics)
 		if err != nil {
 			return nil, err
 		}
-		if blockInfo == nil {
-			// No arbitrum txes in this block
-			continue
-		}
-		if !maybeMatchesLogQuery(blockInfo.Header.Bloom, address, topics) {
-			continue
-		}
+		logs = append(logs, blockLogs...)
+	}
+	return logs, nil
+}
 
-		res, err := evm.NewBlockResultFromValue(blockInfo.BlockLog)
+func (txdb *View) blockLogs(
+	height uint64,
+	address []common.Address,
+	topics [][]common.Hash,
+) ([]evm.FullLog, error) {
+	blockInfo, err := txdb.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if blockInfo == nil || blockInfo.BlockLog == nil {
+		// No arbitrum txes in this block
+		return nil, nil
+	}
+	if !maybeMatchesLogQuery(blockInfo.Header.Bloom, address, topics) {
+		return nil, nil
+	}
+
+	res, err := evm.NewBlockResultFromValue(blockInfo.BlockLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []evm.FullLog
+	first := res.FirstAVMLog().Uint64()
+	for j := uint64(0); j < res.BlockStats.AVMLogCount.Uint64(); j++ {
+		logVal, err := txdb.GetLog(first + j)
 		if err != nil {
 			return nil, err
 		}
 
-		first := res.FirstAVMLog().Uint64()
-		for j := uint64(0); j < res.BlockStats.AVMLogCount.Uint64(); j++ {
-			logVal, err := txdb.GetLog(first + j)
-			if err != nil {
-				return nil, err
-			}
-
-			res, err := evm.NewTxResultFromValue(logVal)
-			if err != nil {
-				return nil, err
-			}
+		res, err := evm.NewTxResultFromValue(logVal)
+		if err != nil {
+			return nil, err
+		}
 
-			logIndex := uint64(0)
-			for _, evmLog := range res.EVMLogs {
-				if evmLog.MatchesQuery(address, topics) {
-					logs = append(logs, evm.FullLog{
-						Log:     evmLog,
-						TxIndex: j,
-						TxHash:  res.IncomingRequest.MessageID,
-						Index:   logIndex,
-						Block: &common.BlockId{
-							Height:     common.NewTimeBlocks(blockInfo.Header.Number),
-							HeaderHash: common.NewHashFromEth(blockInfo.Header.Hash()),
-						},
-					})
-				}
-				logIndex++
+		logIndex := uint64(0)
+		for _, evmLog := range res.EVMLogs {
+			if evmLog.MatchesQuery(address, topics) {
+				logs = append(logs, evm.FullLog{
+					Log:     evmLog,
+					TxIndex: j,
+					TxHash:  res.IncomingRequest.MessageID,
+					Index:   logIndex,
+					Block: &common.BlockId{
+						Height:     common.NewTimeBlocks(blockInfo.Header.Number),
+						HeaderHash: common.NewHashFromEth(blockInfo.Header.Hash()),
+					},
+				})
 			}
+			logIndex++
 		}
 	}
 	return logs, nil
 }
 
+// logQueryFilters flattens the address and topic filter clauses into the
+// format used by bloombits.Matcher
+func logQueryFilters(addresses []common.Address, topics [][]common.Hash) [][][]byte {
+	var filters [][][]byte
+	if len(addresses) > 0 {
+		filter := make([][]byte, 0, len(addresses))
+		for _, addr := range addresses {
+			filter = append(filter, addr.Bytes())
+		}
+		filters = append(filters, filter)
+	}
+	for _, topicGroup := range topics {
+		if len(topicGroup) == 0 {
+			continue
+		}
+		filter := make([][]byte, 0, len(topicGroup))
+		for _, topic := range topicGroup {
+			filter = append(filter, topic.Bytes())
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
 func maybeMatchesLogQuery(logFilter types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		match := false
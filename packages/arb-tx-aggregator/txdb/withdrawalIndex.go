@@ -0,0 +1,308 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"encoding/binary"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+var (
+	withdrawalPrefix     = []byte("withdrawal")
+	withdrawalTxPrefix   = []byte("txWithdrawal")
+	withdrawalDestPrefix = []byte("destWithdrawal")
+)
+
+// Withdrawal is an ETH, ERC20 or ERC721 withdrawal emitted by ArbSys along
+// with the AVM send which carries it to L1
+type Withdrawal struct {
+	Kind inbox.Type
+	Data []byte
+
+	// Sender is the L2 account which made the withdrawal
+	Sender common.Address
+
+	// TxHash is the L2 transaction which made the withdrawal
+	TxHash common.Hash
+
+	// LogIndex is the index of the AVM log containing the transaction's
+	// result
+	LogIndex  uint64
+	BlockNum  *big.Int
+	SendIndex uint64
+}
+
+// Message returns the message.Eth, message.ERC20 or message.ERC721 sent to L1
+func (w *Withdrawal) Message() (message.Message, error) {
+	return message.NestedMessage(w.Data, w.Kind)
+}
+
+// TransferDest returns the recipient of an Eth, ERC20 or ERC721 message
+func TransferDest(msg message.Message) common.Address {
+	switch msg := msg.(type) {
+	case message.Eth:
+		return msg.Dest
+	case message.ERC20:
+		return msg.Dest
+	case message.ERC721:
+		return msg.Dest
+	default:
+		return common.Address{}
+	}
+}
+
+// withdrawalIndex stores withdrawals by send index along with lookup keys by
+// L2 transaction and by recipient.
+//
+// Send indexes are reused after a reorg, so lookup keys may refer to a
+// withdrawal that has been replaced. They're checked against the stored
+// withdrawal when read
+type withdrawalIndex struct {
+	db ethdb.Database
+}
+
+func newWithdrawalIndex(db ethdb.Database) *withdrawalIndex {
+	return &withdrawalIndex{db: db}
+}
+
+func withdrawalKey(sendIndex uint64) []byte {
+	return append(append([]byte{}, withdrawalPrefix...), encodeUint64(sendIndex)...)
+}
+
+func withdrawalTxKey(txHash common.Hash, sendIndex uint64) []byte {
+	key := append(append([]byte{}, withdrawalTxPrefix...), txHash.Bytes()...)
+	return append(key, encodeUint64(sendIndex)...)
+}
+
+func withdrawalDestKey(dest common.Address, sendIndex uint64) []byte {
+	key := append(append([]byte{}, withdrawalDestPrefix...), dest.Bytes()...)
+	return append(key, encodeUint64(sendIndex)...)
+}
+
+// parseWithdrawals finds the withdrawal events emitted by a block's
+// transactions. startLog is the log index of the first result
+func parseWithdrawals(startLog uint64, results []*evm.TxResult) []*Withdrawal {
+	var withdrawals []*Withdrawal
+	for i, res := range results {
+		for _, ethLog := range res.EVMLogs {
+			msg := snapshot.ParseWithdrawal(ethLog)
+			if msg == nil {
+				continue
+			}
+			withdrawals = append(withdrawals, &Withdrawal{
+				Kind:     msg.Type(),
+				Data:     msg.AsData(),
+				Sender:   res.IncomingRequest.Sender,
+				TxHash:   res.IncomingRequest.MessageID,
+				LogIndex: startLog + uint64(i),
+				BlockNum: new(big.Int).Set(res.IncomingRequest.ChainTime.BlockNum.AsInt()),
+			})
+		}
+	}
+	return withdrawals
+}
+
+// assignSendIndexes pairs withdrawals with the transfers among a block's
+// sends in order. firstSend is the index of the block's first send and sends
+// are its output messages, which are nil if they couldn't be parsed.
+// Withdrawals that can't be paired are dropped
+func assignSendIndexes(withdrawals []*Withdrawal, firstSend uint64, sends []*message.OutMessage) []*Withdrawal {
+	next := 0
+	for i, send := range sends {
+		if next == len(withdrawals) {
+			break
+		}
+		if send == nil || send.Kind != withdrawals[next].Kind {
+			continue
+		}
+		withdrawals[next].SendIndex = firstSend + uint64(i)
+		next++
+	}
+	return withdrawals[:next]
+}
+
+// indexWithdrawals records the withdrawals made in a block. The block's
+// sends must already have been saved
+func (db *TxDB) indexWithdrawals(info *evm.BlockInfo, startLog uint64, results []*evm.TxResult) error {
+	withdrawals := parseWithdrawals(startLog, results)
+	if len(withdrawals) == 0 {
+		return nil
+	}
+	sendCount := info.BlockStats.AVMSendCount.Uint64()
+	firstSend := info.ChainStats.AVMSendCount.Uint64() - sendCount
+	sends := make([]*message.OutMessage, 0, sendCount)
+	for i := uint64(0); i < sendCount; i++ {
+		val, err := db.as.GetMessage(firstSend + i)
+		if err != nil {
+			return err
+		}
+		send, err := message.NewOutMessageFromValue(val)
+		if err != nil {
+			log.Println("Error parsing send", firstSend+i, err)
+			sends = append(sends, nil)
+			continue
+		}
+		sends = append(sends, &send)
+	}
+	paired := assignSendIndexes(withdrawals, firstSend, sends)
+	if len(paired) != len(withdrawals) {
+		log.Println("Couldn't find sends for", len(withdrawals)-len(paired), "withdrawals in block", info.BlockNum)
+	}
+	return db.withdrawals.addWithdrawals(paired)
+}
+
+// GetWithdrawalsByTx returns the withdrawals made by an L2 transaction
+func (db *TxDB) GetWithdrawalsByTx(txHash common.Hash) ([]*Withdrawal, error) {
+	withdrawals, err := db.withdrawals.withdrawalsByTx(txHash)
+	if err != nil {
+		return nil, err
+	}
+	return db.currentWithdrawals(withdrawals)
+}
+
+// GetWithdrawalsByDest returns the withdrawals to an L1 account
+func (db *TxDB) GetWithdrawalsByDest(dest common.Address) ([]*Withdrawal, error) {
+	withdrawals, err := db.withdrawals.withdrawalsByDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	return db.currentWithdrawals(withdrawals)
+}
+
+// GetAssertionForLog returns the assertion which emitted the log with the
+// given index and whether it has been confirmed. The assertion is nil if the
+// log hasn't been asserted by a node that wasn't rejected
+func (db *TxDB) GetAssertionForLog(logIndex uint64) (*Assertion, bool, error) {
+	assertion, err := db.confirmations.assertionForLog(logIndex)
+	if err != nil || assertion == nil {
+		return nil, false, err
+	}
+	return assertion, assertion.Status == AssertionConfirmed, nil
+}
+
+// currentWithdrawals filters out withdrawals from transactions that were
+// removed by a reorg
+func (db *TxDB) currentWithdrawals(withdrawals []*Withdrawal) ([]*Withdrawal, error) {
+	current := make([]*Withdrawal, 0, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		logVal, logIndex, err := db.GetRequestWithIndex(withdrawal.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if logVal == nil || *logIndex != withdrawal.LogIndex {
+			continue
+		}
+		current = append(current, withdrawal)
+	}
+	return current, nil
+}
+
+func (idx *withdrawalIndex) addWithdrawals(withdrawals []*Withdrawal) error {
+	if len(withdrawals) == 0 {
+		return nil
+	}
+	batch := idx.db.NewBatch()
+	for _, withdrawal := range withdrawals {
+		msg, err := withdrawal.Message()
+		if err != nil {
+			return err
+		}
+		data, err := rlp.EncodeToBytes(withdrawal)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(withdrawalKey(withdrawal.SendIndex), data); err != nil {
+			return err
+		}
+		if err := batch.Put(withdrawalTxKey(withdrawal.TxHash, withdrawal.SendIndex), []byte{}); err != nil {
+			return err
+		}
+		if err := batch.Put(withdrawalDestKey(TransferDest(msg), withdrawal.SendIndex), []byte{}); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// withdrawal returns nil if no withdrawal is stored with the send index
+func (idx *withdrawalIndex) withdrawal(sendIndex uint64) (*Withdrawal, error) {
+	key := withdrawalKey(sendIndex)
+	has, err := idx.db.Has(key)
+	if err != nil || !has {
+		return nil, err
+	}
+	data, err := idx.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	withdrawal := new(Withdrawal)
+	if err := rlp.DecodeBytes(data, withdrawal); err != nil {
+		return nil, err
+	}
+	return withdrawal, nil
+}
+
+// withdrawalsWithPrefix returns the stored withdrawals whose send indexes are
+// listed under prefix and which match
+func (idx *withdrawalIndex) withdrawalsWithPrefix(prefix []byte, match func(*Withdrawal) bool) ([]*Withdrawal, error) {
+	it := idx.db.NewIterator(prefix, nil)
+	var sendIndexes []uint64
+	for it.Next() {
+		sendIndexes = append(sendIndexes, binary.BigEndian.Uint64(it.Key()[len(prefix):]))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	withdrawals := make([]*Withdrawal, 0, len(sendIndexes))
+	for _, sendIndex := range sendIndexes {
+		withdrawal, err := idx.withdrawal(sendIndex)
+		if err != nil {
+			return nil, err
+		}
+		if withdrawal != nil && match(withdrawal) {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+	return withdrawals, nil
+}
+
+func (idx *withdrawalIndex) withdrawalsByTx(txHash common.Hash) ([]*Withdrawal, error) {
+	prefix := append(append([]byte{}, withdrawalTxPrefix...), txHash.Bytes()...)
+	return idx.withdrawalsWithPrefix(prefix, func(withdrawal *Withdrawal) bool {
+		return withdrawal.TxHash == txHash
+	})
+}
+
+func (idx *withdrawalIndex) withdrawalsByDest(dest common.Address) ([]*Withdrawal, error) {
+	prefix := append(append([]byte{}, withdrawalDestPrefix...), dest.Bytes()...)
+	return idx.withdrawalsWithPrefix(prefix, func(withdrawal *Withdrawal) bool {
+		msg, err := withdrawal.Message()
+		return err == nil && TransferDest(msg) == dest
+	})
+}
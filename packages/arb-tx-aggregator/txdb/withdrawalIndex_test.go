@@ -0,0 +1,117 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func newTestWithdrawal(msg message.Message, txHash common.Hash) *Withdrawal {
+	return &Withdrawal{
+		Kind:     msg.Type(),
+		Data:     msg.AsData(),
+		Sender:   common.Address{9},
+		TxHash:   txHash,
+		BlockNum: big.NewInt(3),
+	}
+}
+
+func TestAssignSendIndexes(t *testing.T) {
+	eth := message.Eth{Dest: common.Address{1}, Value: big.NewInt(5)}
+	erc20 := message.ERC20{Token: common.Address{2}, Dest: common.Address{1}, Value: big.NewInt(6)}
+	withdrawals := []*Withdrawal{
+		newTestWithdrawal(eth, common.Hash{1}),
+		newTestWithdrawal(erc20, common.Hash{2}),
+		newTestWithdrawal(eth, common.Hash{3}),
+	}
+	ethSend := message.NewOutMessage(eth, common.Address{9})
+	erc20Send := message.NewOutMessage(erc20, common.Address{9})
+	otherSend := message.NewOutMessage(message.L2Message{Data: []byte{1}}, common.Address{9})
+	sends := []*message.OutMessage{&otherSend, &ethSend, nil, &erc20Send}
+
+	paired := assignSendIndexes(withdrawals, 20, sends)
+	if len(paired) != 2 {
+		t.Fatal("expected 2 withdrawals to be paired but got", len(paired))
+	}
+	if paired[0].SendIndex != 21 || paired[1].SendIndex != 23 {
+		t.Error("wrong send indexes", paired[0].SendIndex, paired[1].SendIndex)
+	}
+}
+
+func TestWithdrawalIndex(t *testing.T) {
+	dest := common.Address{1}
+	otherDest := common.Address{2}
+	idx := newWithdrawalIndex(rawdb.NewMemoryDatabase())
+
+	first := newTestWithdrawal(message.Eth{Dest: dest, Value: big.NewInt(5)}, common.Hash{1})
+	first.SendIndex = 4
+	second := newTestWithdrawal(message.ERC721{Token: common.Address{3}, Dest: dest, ID: big.NewInt(7)}, common.Hash{1})
+	second.SendIndex = 5
+	if err := idx.addWithdrawals([]*Withdrawal{first, second}); err != nil {
+		t.Fatal(err)
+	}
+
+	byTx, err := idx.withdrawalsByTx(common.Hash{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTx) != 2 || byTx[0].SendIndex != 4 || byTx[1].SendIndex != 5 {
+		t.Fatal("unexpected withdrawals by tx", byTx)
+	}
+	msg, err := byTx[1].Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if erc721, ok := msg.(message.ERC721); !ok || erc721.ID.Cmp(big.NewInt(7)) != 0 {
+		t.Error("unexpected withdrawal message", msg)
+	}
+
+	// A reorg reuses send index 5 for a withdrawal to a different account
+	replacement := newTestWithdrawal(message.Eth{Dest: otherDest, Value: big.NewInt(8)}, common.Hash{2})
+	replacement.SendIndex = 5
+	if err := idx.addWithdrawals([]*Withdrawal{replacement}); err != nil {
+		t.Fatal(err)
+	}
+
+	byDest, err := idx.withdrawalsByDest(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byDest) != 1 || byDest[0].SendIndex != 4 {
+		t.Fatal("unexpected withdrawals by dest", byDest)
+	}
+	byTx, err = idx.withdrawalsByTx(common.Hash{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTx) != 1 {
+		t.Fatal("replaced withdrawal still found by tx")
+	}
+	byDest, err = idx.withdrawalsByDest(otherDest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byDest) != 1 || byDest[0].TxHash != (common.Hash{2}) {
+		t.Fatal("unexpected withdrawals to other dest", byDest)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const (
+	defaultAddressTxLimit = 100
+	maxAddressTxLimit     = 1000
+)
+
+// GetTransactionsByAddress returns a page of the transactions sent by, sent
+// to, or which created an account, most recent first
+func (a *Arb) GetTransactionsByAddress(ctx context.Context, args TransactionsByAddressArgs) (*TransactionsByAddressResult, error) {
+	limit := uint64(defaultAddressTxLimit)
+	if args.Limit != nil {
+		limit = uint64(*args.Limit)
+	}
+	if limit == 0 || limit > maxAddressTxLimit {
+		return nil, errors.New("limit must be between 1 and 1000")
+	}
+	var before *uint64
+	if args.Before != nil {
+		cursor := uint64(*args.Before)
+		before = &cursor
+	}
+	txs, err := a.srv.GetTransactionsByAddress(arbcommon.NewAddressFromEth(args.Address), before, int(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TransactionsByAddressResult{
+		Transactions: make([]*AddressTransactionResult, 0, len(txs)),
+	}
+	for _, tx := range txs {
+		res := tx.Result
+		result.Transactions = append(result.Transactions, &AddressTransactionResult{
+			Hash:             tx.RequestId.ToEthHash(),
+			BlockNumber:      (*hexutil.Big)(res.IncomingRequest.ChainTime.BlockNum.AsInt()),
+			TransactionIndex: hexutil.Uint64(res.TxIndex.Uint64()),
+			From:             res.IncomingRequest.Sender.ToEthAddress(),
+			ReturnCode:       hexutil.Uint64(res.ResultCode),
+		})
+	}
+	if uint64(len(txs)) == limit {
+		next := hexutil.Uint64(txs[len(txs)-1].LogIndex)
+		result.Next = &next
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// Arb implements the arb namespace which contains Arbitrum specific methods
+type Arb struct {
+	srv *aggregator.Server
+}
+
+func NewArb(srv *aggregator.Server) *Arb {
+	return &Arb{srv: srv}
+}
+
+// GetTransactionStatus returns the stage a transaction has reached: queued,
+// pending or sent in the batcher, then included, asserted and confirmed once
+// the rollup chain has executed it
+func (a *Arb) GetTransactionStatus(ctx context.Context, txHash common.Hash) (*TransactionStatusResult, error) {
+	status, err := a.srv.GetTransactionStatus(arbcommon.NewHashFromEth(txHash))
+	if err != nil {
+		return nil, err
+	}
+	result := &TransactionStatusResult{
+		Status:      status.Stage,
+		BlockNumber: (*hexutil.Big)(status.BlockNum),
+		Confirmed:   status.Confirmed,
+	}
+	if status.BatchTxHash != nil {
+		batchTxHash := status.BatchTxHash.ToEthHash()
+		result.BatchTxHash = &batchTxHash
+	}
+	return result, nil
+}
+
+// GetBatchByL1Tx returns the inbox messages delivered by an L1 transaction
+// along with the L2 transactions each of them contained
+func (a *Arb) GetBatchByL1Tx(ctx context.Context, l1TxHash common.Hash) ([]*InboxBatchResult, error) {
+	batches, err := a.srv.GetBatchesByL1Tx(arbcommon.NewHashFromEth(l1TxHash))
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*InboxBatchResult, 0, len(batches))
+	for _, batch := range batches {
+		results = append(results, makeInboxBatchResult(batch))
+	}
+	return results, nil
+}
+
+// GetBatchByInboxSeqNum returns null if the inbox message hasn't been seen
+func (a *Arb) GetBatchByInboxSeqNum(ctx context.Context, seqNum *hexutil.Big) (*InboxBatchResult, error) {
+	batch, err := a.srv.GetBatchByInboxSeqNum(seqNum.ToInt())
+	if err != nil || batch == nil {
+		return nil, err
+	}
+	return makeInboxBatchResult(batch), nil
+}
+
+// GetL1OriginOfTx returns null if the transaction hasn't been included
+func (a *Arb) GetL1OriginOfTx(ctx context.Context, txHash common.Hash) (*L1OriginResult, error) {
+	origin, err := a.srv.GetL1Origin(arbcommon.NewHashFromEth(txHash))
+	if err != nil || origin == nil {
+		return nil, err
+	}
+	result := &L1OriginResult{
+		InboxSeqNum:   (*hexutil.Big)(origin.InboxSeqNum),
+		IndexInParent: (*hexutil.Big)(origin.IndexInParent),
+	}
+	if origin.IndexInParent != nil {
+		parent := origin.ParentRequestId.ToEthHash()
+		result.ParentRequestId = &parent
+	}
+	if origin.Origin != nil {
+		l1TxHash := origin.Origin.TxHash.ToEthHash()
+		l1BlockHash := origin.Origin.BlockHash.ToEthHash()
+		result.L1TxHash = &l1TxHash
+		result.L1BlockHash = &l1BlockHash
+		result.L1BlockNumber = (*hexutil.Big)(origin.Origin.BlockNum)
+	}
+	return result, nil
+}
+
+func makeInboxBatchResult(batch *aggregator.Batch) *InboxBatchResult {
+	txes := make([]common.Hash, 0, len(batch.Requests))
+	for _, requestId := range batch.Requests {
+		txes = append(txes, requestId.ToEthHash())
+	}
+	return &InboxBatchResult{
+		InboxSeqNum:   (*hexutil.Big)(batch.Origin.InboxSeqNum),
+		Kind:          hexutil.Uint64(batch.Origin.Kind),
+		Sender:        batch.Origin.Sender.ToEthAddress(),
+		L1TxHash:      batch.Origin.TxHash.ToEthHash(),
+		L1BlockHash:   batch.Origin.BlockHash.ToEthHash(),
+		L1BlockNumber: (*hexutil.Big)(batch.Origin.BlockNum),
+		L1LogIndex:    hexutil.Uint64(batch.Origin.LogIndex),
+		Transactions:  txes,
+	}
+}
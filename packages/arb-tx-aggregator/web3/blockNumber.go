@@ -0,0 +1,79 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+)
+
+// BlockNumber is an rpc.BlockNumber which also accepts the "safe" and
+// "finalized" tags
+type BlockNumber rpc.BlockNumber
+
+func finalityTag(input string) (rpc.BlockNumber, bool) {
+	switch strings.Trim(input, `"`) {
+	case "safe":
+		return aggregator.SafeBlockNumber, true
+	case "finalized":
+		return aggregator.FinalizedBlockNumber, true
+	default:
+		return 0, false
+	}
+}
+
+func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
+	if tag, ok := finalityTag(string(data)); ok {
+		*bn = BlockNumber(tag)
+		return nil
+	}
+	return (*rpc.BlockNumber)(bn).UnmarshalJSON(data)
+}
+
+// BlockNumberOrHash is an rpc.BlockNumberOrHash which also accepts the "safe"
+// and "finalized" tags
+type BlockNumberOrHash struct {
+	rpc.BlockNumberOrHash
+}
+
+func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
+	if tag, ok := finalityTag(string(data)); ok {
+		bnh.BlockNumberOrHash = rpc.BlockNumberOrHashWithNumber(tag)
+		return nil
+	}
+	var obj struct {
+		BlockNumber *BlockNumber `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(data, &obj); err == nil && obj.BlockNumber != nil {
+		if tag := rpc.BlockNumber(*obj.BlockNumber); tag == aggregator.SafeBlockNumber || tag == aggregator.FinalizedBlockNumber {
+			bnh.BlockNumberOrHash = rpc.BlockNumberOrHashWithNumber(tag)
+			return nil
+		}
+	}
+	return bnh.BlockNumberOrHash.UnmarshalJSON(data)
+}
+
+func (bnh *BlockNumberOrHash) rpcBlockNumberOrHash() *rpc.BlockNumberOrHash {
+	if bnh == nil {
+		return nil
+	}
+	return &bnh.BlockNumberOrHash
+}
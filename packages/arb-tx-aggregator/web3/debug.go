@@ -0,0 +1,146 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// Debug implements the debug namespace. Traces are produced by re-executing
+// transactions against an aggregator snapshot. ArbOS does not report the
+// internal calls made during execution, so a trace consists of the top level
+// call frame only.
+type Debug struct {
+	s *Server
+}
+
+func NewDebug(s *Server) *Debug {
+	return &Debug{s: s}
+}
+
+// callTracer is the name of the geth tracer whose output traces resemble
+const callTracer = "callTracer"
+
+func checkTraceConfig(config *TraceConfig) error {
+	if config == nil || config.Tracer == nil || *config.Tracer == callTracer {
+		return nil
+	}
+	return fmt.Errorf("tracer %q is not supported, only %v is available", *config.Tracer, callTracer)
+}
+
+func (d *Debug) TraceTransaction(txHash hexutil.Bytes, config *TraceConfig) (*TransactionTrace, error) {
+	if err := checkTraceConfig(config); err != nil {
+		return nil, err
+	}
+	var requestId arbcommon.Hash
+	copy(requestId[:], txHash)
+	res, err := d.s.srv.ReplayTransaction(requestId)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := evm.GetTransaction(res)
+	if err != nil {
+		return nil, err
+	}
+	return makeTransactionTrace(
+		res,
+		res.IncomingRequest.Sender.ToEthAddress(),
+		tx.Tx.To(),
+		tx.Tx.Value(),
+		tx.Tx.Gas(),
+		tx.Tx.Data(),
+	), nil
+}
+
+func (d *Debug) TraceCall(callArgs CallTxArgs, blockNum *BlockNumber, config *TraceConfig) (*TransactionTrace, error) {
+	if err := checkTraceConfig(config); err != nil {
+		return nil, err
+	}
+	res, err := d.s.executeCall(callArgs, (*rpc.BlockNumber)(blockNum))
+	if err != nil {
+		return nil, err
+	}
+	from, msg := buildCallMsg(callArgs)
+	msg = d.s.srv.AdjustGas(msg)
+	var to *common.Address
+	if callArgs.To != nil {
+		dest := *callArgs.To
+		to = &dest
+	}
+	return makeTransactionTrace(
+		res,
+		from.ToEthAddress(),
+		to,
+		msg.Payment,
+		msg.MaxGas.Uint64(),
+		msg.Data,
+	), nil
+}
+
+func makeTransactionTrace(
+	res *evm.TxResult,
+	from common.Address,
+	to *common.Address,
+	value *big.Int,
+	gas uint64,
+	input []byte,
+) *TransactionTrace {
+	frameType := "CALL"
+	if to == nil || *to == (common.Address{}) {
+		frameType = "CREATE"
+	}
+
+	var errorMsg, revertReason string
+	if res.ResultCode != evm.ReturnCode {
+		errorMsg = res.ResultCode.String()
+	}
+	if res.ResultCode == evm.RevertCode {
+		reason, err := abi.UnpackRevert(res.ReturnData)
+		if err == nil {
+			revertReason = reason
+		}
+	}
+
+	frame := &CallFrame{
+		Type:         frameType,
+		From:         from,
+		To:           to,
+		Value:        (*hexutil.Big)(value),
+		Gas:          hexutil.Uint64(gas),
+		GasUsed:      hexutil.Uint64(res.GasUsed.Uint64()),
+		Input:        input,
+		Output:       res.ReturnData,
+		Error:        errorMsg,
+		RevertReason: revertReason,
+		Logs:         res.EthLogs(arbcommon.Hash{}),
+	}
+	return &TransactionTrace{
+		CallFrame:    frame,
+		TopLevelOnly: true,
+		ReturnCode:   hexutil.Uint64(res.ResultCode),
+		GasPrice:     (*hexutil.Big)(res.GasPrice),
+	}
+}
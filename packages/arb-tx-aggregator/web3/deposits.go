@@ -0,0 +1,174 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// depositChanSize is the size of the channel buffering deposits for each
+// subscription
+const depositChanSize = 100
+
+// GetDepositStatus returns the deposits made by an L1 transaction or with the
+// given inbox sequence number along with their L2 results
+func (a *Arb) GetDepositStatus(ctx context.Context, args DepositStatusArgs) ([]*DepositResult, error) {
+	var statuses []*aggregator.DepositStatus
+	switch {
+	case args.L1TxHash != nil:
+		txStatuses, err := a.srv.GetDepositStatusesForL1Tx(arbcommon.NewHashFromEth(*args.L1TxHash))
+		if err != nil {
+			return nil, err
+		}
+		for _, status := range txStatuses {
+			if args.InboxSeqNum == nil || status.Origin.InboxSeqNum.Cmp(args.InboxSeqNum.ToInt()) == 0 {
+				statuses = append(statuses, status)
+			}
+		}
+	case args.InboxSeqNum != nil:
+		status, err := a.srv.GetDepositStatus(args.InboxSeqNum.ToInt())
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			statuses = append(statuses, status)
+		}
+	default:
+		return nil, errors.New("l1TxHash or inboxSeqNum is required")
+	}
+
+	results := make([]*DepositResult, 0, len(statuses))
+	for _, status := range statuses {
+		result := &DepositResult{
+			Status:      "pending",
+			Kind:        transferKindName(inbox.Type(status.Origin.Kind)),
+			InboxSeqNum: (*hexutil.Big)(status.Origin.InboxSeqNum),
+			Sender:      status.Origin.Sender.ToEthAddress(),
+		}
+		fillDepositOrigin(result, status.Origin)
+		if status.Deposit != nil {
+			fillDepositResult(result, status.Deposit)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Deposits creates a subscription which is notified of each deposit to dest
+// once it has been executed on L2
+func (a *Arb) Deposits(ctx context.Context, dest common.Address) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		deposits := make(chan []*txdb.Deposit, depositChanSize)
+		depositSub := a.srv.SubscribeDepositEvent(deposits)
+		defer depositSub.Unsubscribe()
+		for {
+			select {
+			case batch := <-deposits:
+				for _, deposit := range batch {
+					if deposit.Dest().ToEthAddress() != dest {
+						continue
+					}
+					result := &DepositResult{
+						Kind:        transferKindName(deposit.Message.Type()),
+						InboxSeqNum: (*hexutil.Big)(deposit.InboxSeqNum()),
+						Sender:      deposit.Result.IncomingRequest.Sender.ToEthAddress(),
+					}
+					fillDepositResult(result, deposit)
+					if batch, err := a.srv.GetBatchByInboxSeqNum(deposit.InboxSeqNum()); err == nil && batch != nil {
+						fillDepositOrigin(result, batch.Origin)
+					}
+					if err := notifier.Notify(rpcSub.ID, result); err != nil {
+						return
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+func transferKindName(kind inbox.Type) string {
+	switch kind {
+	case message.EthType:
+		return "eth"
+	case message.ERC20Type:
+		return "erc20"
+	case message.ERC721Type:
+		return "erc721"
+	default:
+		return "unknown"
+	}
+}
+
+// transferDetails returns the recipient, token and value or token id of an
+// Eth, ERC20 or ERC721 message. The token is nil for Eth
+func transferDetails(msg message.Message) (common.Address, *common.Address, *hexutil.Big) {
+	switch msg := msg.(type) {
+	case message.Eth:
+		return msg.Dest.ToEthAddress(), nil, (*hexutil.Big)(msg.Value)
+	case message.ERC20:
+		token := msg.Token.ToEthAddress()
+		return msg.Dest.ToEthAddress(), &token, (*hexutil.Big)(msg.Value)
+	case message.ERC721:
+		token := msg.Token.ToEthAddress()
+		return msg.Dest.ToEthAddress(), &token, (*hexutil.Big)(msg.ID)
+	default:
+		return common.Address{}, nil, nil
+	}
+}
+
+func fillDepositOrigin(result *DepositResult, origin *txdb.InboxMessageOrigin) {
+	l1TxHash := origin.TxHash.ToEthHash()
+	result.L1TxHash = &l1TxHash
+	result.L1BlockNumber = (*hexutil.Big)(origin.BlockNum)
+}
+
+func fillDepositResult(result *DepositResult, deposit *txdb.Deposit) {
+	result.Status = "failed"
+	if deposit.Credited() {
+		result.Status = "credited"
+	}
+	dest, token, value := transferDetails(deposit.Message)
+	result.Dest = &dest
+	result.Token = token
+	result.Value = value
+	requestId := deposit.Result.IncomingRequest.MessageID.ToEthHash()
+	result.RequestId = &requestId
+	resultCode := hexutil.Uint64(deposit.Result.ResultCode)
+	result.ResultCode = &resultCode
+}
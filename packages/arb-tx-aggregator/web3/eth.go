@@ -7,6 +7,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
 	errors2 "github.com/pkg/errors"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -48,8 +49,8 @@ func (s *Server) BlockNumber() hexutil.Uint64 {
 	return hexutil.Uint64(s.srv.GetBlockCount())
 }
 
-func (s *Server) GetBalance(address *common.Address, blockNum *rpc.BlockNumber) (*hexutil.Big, error) {
-	snap, err := s.getSnapshot(blockNum)
+func (s *Server) GetBalance(address *common.Address, blockNum *BlockNumber) (*hexutil.Big, error) {
+	snap, err := s.getSnapshot((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -60,8 +61,8 @@ func (s *Server) GetBalance(address *common.Address, blockNum *rpc.BlockNumber)
 	return (*hexutil.Big)(balance), nil
 }
 
-func (s *Server) GetStorageAt(address *common.Address, index *hexutil.Big, blockNum *rpc.BlockNumber) (*hexutil.Big, error) {
-	snap, err := s.getSnapshot(blockNum)
+func (s *Server) GetStorageAt(address *common.Address, index *hexutil.Big, blockNum *BlockNumber) (*hexutil.Big, error) {
+	snap, err := s.getSnapshot((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -72,15 +73,15 @@ func (s *Server) GetStorageAt(address *common.Address, index *hexutil.Big, block
 	return (*hexutil.Big)(storageVal), nil
 }
 
-func (s *Server) GetTransactionCount(ctx context.Context, address *common.Address, blockNum *rpc.BlockNumber) (hexutil.Uint64, error) {
+func (s *Server) GetTransactionCount(ctx context.Context, address *common.Address, blockNum *BlockNumber) (hexutil.Uint64, error) {
 	account := arbcommon.NewAddressFromEth(*address)
-	if blockNum == nil || *blockNum == rpc.PendingBlockNumber {
+	if blockNum == nil || rpc.BlockNumber(*blockNum) == rpc.PendingBlockNumber {
 		count := s.srv.PendingTransactionCount(ctx, account)
 		if count != nil {
 			return hexutil.Uint64(*count), nil
 		}
 	}
-	snap, err := s.getSnapshot(blockNum)
+	snap, err := s.getSnapshot((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return 0, err
 	}
@@ -99,8 +100,8 @@ func (s *Server) GetBlockTransactionCountByHash(blockHash common.Hash) (*hexutil
 	return s.getBlockTransactionCount(info)
 }
 
-func (s *Server) GetBlockTransactionCountByNumber(blockNum *rpc.BlockNumber) (*hexutil.Big, error) {
-	height, err := s.blockNum(blockNum)
+func (s *Server) GetBlockTransactionCountByNumber(blockNum *BlockNumber) (*hexutil.Big, error) {
+	height, err := s.blockNum((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -111,8 +112,8 @@ func (s *Server) GetBlockTransactionCountByNumber(blockNum *rpc.BlockNumber) (*h
 	return s.getBlockTransactionCount(info)
 }
 
-func (s *Server) GetCode(address *common.Address, blockNum *rpc.BlockNumber) (hexutil.Bytes, error) {
-	snap, err := s.getSnapshot(blockNum)
+func (s *Server) GetCode(address *common.Address, blockNum *BlockNumber) (hexutil.Bytes, error) {
+	snap, err := s.getSnapshot((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -135,21 +136,43 @@ func (s *Server) SendRawTransaction(ctx context.Context, data hexutil.Bytes) (he
 	return tx.Hash().Bytes(), nil
 }
 
-func (s *Server) Call(callArgs CallTxArgs, blockNum *rpc.BlockNumber) (hexutil.Bytes, error) {
-	res, err := s.executeCall(callArgs, blockNum)
+// Call executes a call against the state at the given block, which may be
+// specified by number or by hash, after applying any state overrides.
+// Overrides can't modify the code or storage of an existing contract since
+// ArbOS provides no way to do so, and fail with
+// snapshot.ErrUnsupportedOverride if they try. Only the code and storage of
+// accounts without code can be set
+func (s *Server) Call(callArgs CallTxArgs, blockNrOrHash *BlockNumberOrHash, overrides *map[common.Address]AccountOverrideArgs) (hexutil.Bytes, error) {
+	snap, err := s.getSnapshotByNumberOrHash(blockNrOrHash.rpcBlockNumberOrHash())
 	if err != nil {
 		return nil, err
 	}
+	if overrides != nil {
+		snap, err = applyOverrides(snap, *overrides)
+		if err != nil {
+			return nil, err
+		}
+	}
+	from, msg := buildCallMsg(callArgs)
+	msg = s.srv.AdjustGas(msg)
+	res, err := snap.Call(msg, from)
+	if err != nil {
+		return nil, err
+	}
+	if res.ResultCode != evm.ReturnCode {
+		return nil, snapshot.NewExecutionError(res)
+	}
 	return res.ReturnData, nil
 }
 
+// EstimateGas binary searches for the lowest gas limit at which the call
+// succeeds against the pending state, bounded by the gas limit provided in
+// args and the maximum gas allowed for a call
 func (s *Server) EstimateGas(args CallTxArgs) (hexutil.Uint64, error) {
-	blockNum := rpc.PendingBlockNumber
-	res, err := s.executeCall(args, &blockNum)
-	if err != nil {
-		return 0, err
-	}
-	return hexutil.Uint64(res.GasUsed.Uint64() + 1000000), nil
+	from, msg := buildCallMsg(args)
+	msg = s.srv.AdjustGas(msg)
+	gas, err := s.srv.PendingSnapshot().EstimateGas(msg, from)
+	return hexutil.Uint64(gas), err
 }
 
 func (s *Server) GetBlockByHash(blockHashRaw hexutil.Bytes, includeTxData bool) (*GetBlockResult, error) {
@@ -162,8 +185,11 @@ func (s *Server) GetBlockByHash(blockHashRaw hexutil.Bytes, includeTxData bool)
 	return s.getBlock(info, includeTxData)
 }
 
-func (s *Server) GetBlockByNumber(blockNum *rpc.BlockNumber, includeTxData bool) (*GetBlockResult, error) {
-	height, err := s.blockNum(blockNum)
+func (s *Server) GetBlockByNumber(blockNum *BlockNumber, includeTxData bool) (*GetBlockResult, error) {
+	if rpc.BlockNumber(*blockNum) == rpc.PendingBlockNumber {
+		return s.getPendingBlock(includeTxData)
+	}
+	height, err := s.blockNum((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -221,8 +247,8 @@ func (s *Server) GetTransactionByBlockHashAndIndex(blockHash common.Hash, index
 	return s.getTransactionByBlockAndIndex(info.Header.Number.Uint64(), index)
 }
 
-func (s *Server) GetTransactionByBlockNumberAndIndex(blockNum *rpc.BlockNumber, index hexutil.Uint64) (*TransactionResult, error) {
-	height, err := s.blockNum(blockNum)
+func (s *Server) GetTransactionByBlockNumberAndIndex(blockNum *BlockNumber, index hexutil.Uint64) (*TransactionResult, error) {
+	height, err := s.blockNum((*rpc.BlockNumber)(blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -236,36 +262,33 @@ func (s *Server) GetTransactionReceipt(txHash hexutil.Bytes) (*GetTransactionRec
 		return nil, err
 	}
 
-	receipt := res.ToEthReceipt(arbcommon.NewHashFromEth(info.Header.Hash()))
-
 	tx, err := evm.GetTransaction(res)
 	if err != nil {
 		return nil, err
 	}
+	return makeReceiptResult(tx, arbcommon.NewHashFromEth(info.Header.Hash())), nil
+}
 
-	var contractAddress *common.Address
-	emptyAddress := common.Address{}
-	if receipt.ContractAddress != emptyAddress {
-		contractAddress = &receipt.ContractAddress
+// GetBlockReceipts returns the receipts of all of the transactions in a block
+// using the block's cached results
+func (s *Server) GetBlockReceipts(blockNrOrHash BlockNumberOrHash) ([]*GetTransactionReceiptResult, error) {
+	info, err := s.blockInfoByNumberOrHash(&blockNrOrHash.BlockNumberOrHash)
+	if err != nil || info == nil {
+		return nil, err
 	}
 
-	return &GetTransactionReceiptResult{
-		TransactionHash:   receipt.TxHash,
-		TransactionIndex:  hexutil.Uint64(receipt.TransactionIndex),
-		BlockHash:         receipt.BlockHash,
-		BlockNumber:       (*hexutil.Big)(receipt.BlockNumber),
-		From:              res.IncomingRequest.Sender.ToEthAddress(),
-		To:                tx.Tx.To(),
-		CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
-		GasUsed:           hexutil.Uint64(receipt.GasUsed),
-		ContractAddress:   contractAddress,
-		Logs:              receipt.Logs,
-		LogsBloom:         receipt.Bloom.Bytes(),
-		Status:            hexutil.Uint64(receipt.Status),
+	results, err := s.srv.GetMachineBlockResults(info)
+	if err != nil {
+		return nil, err
+	}
 
-		ReturnCode: hexutil.Uint64(res.ResultCode),
-		ReturnData: res.ReturnData,
-	}, nil
+	blockHash := arbcommon.NewHashFromEth(info.Header.Hash())
+	processedTxes := evm.FilterEthTxResults(results)
+	receipts := make([]*GetTransactionReceiptResult, 0, len(processedTxes))
+	for _, tx := range processedTxes {
+		receipts = append(receipts, makeReceiptResult(tx, blockHash))
+	}
+	return receipts, nil
 }
 
 func (s *Server) getBlockTransactionCount(block *machine.BlockInfo) (*hexutil.Big, error) {
@@ -336,6 +359,60 @@ func (s *Server) getBlock(block *machine.BlockInfo, includeTxData bool) (*GetBlo
 	return makeBlockResult(block.Header, transactions), nil
 }
 
+// getPendingBlock returns a synthetic block on top of the latest block
+// containing the transactions in the batch currently being assembled
+func (s *Server) getPendingBlock(includeTxData bool) (*GetBlockResult, error) {
+	latest, err := s.srv.BlockInfoByNumber(s.srv.GetBlockCount())
+	if err != nil || latest == nil {
+		return nil, err
+	}
+	return makePendingBlock(latest.Header, s.srv.PendingBatchResults(), includeTxData, time.Now()), nil
+}
+
+func makePendingBlock(latest *types.Header, results []*evm.TxResult, includeTxData bool, now time.Time) *GetBlockResult {
+	processedTxes := evm.FilterEthTxResults(results)
+	gasUsed := uint64(0)
+	receipts := make(types.Receipts, 0, len(processedTxes))
+	for _, res := range processedTxes {
+		gasUsed += res.Result.GasUsed.Uint64()
+		receipts = append(receipts, res.Result.ToEthReceipt(arbcommon.Hash{}))
+	}
+
+	header := &types.Header{
+		ParentHash: latest.Hash(),
+		UncleHash:  latest.UncleHash,
+		Difficulty: latest.Difficulty,
+		Number:     new(big.Int).Add(latest.Number, big.NewInt(1)),
+		GasLimit:   latest.GasLimit,
+		GasUsed:    gasUsed,
+		Time:       uint64(now.Unix()),
+		Bloom:      types.CreateBloom(receipts),
+	}
+
+	var transactions interface{}
+	if includeTxData {
+		txResults := make([]*TransactionResult, 0, len(processedTxes))
+		for _, res := range processedTxes {
+			txRes := makeTransactionResult(res, nil)
+			txRes.BlockNumber = (*hexutil.Big)(header.Number)
+			txResults = append(txResults, txRes)
+		}
+		transactions = txResults
+	} else {
+		txHashes := make([]hexutil.Bytes, 0, len(processedTxes))
+		for _, res := range processedTxes {
+			txHashes = append(txHashes, res.Result.IncomingRequest.MessageID.Bytes())
+		}
+		transactions = txHashes
+	}
+
+	block := makeBlockResult(header, transactions)
+	// Like geth, the pending block has no hash or nonce
+	block.Hash = nil
+	block.Nonce = nil
+	return block
+}
+
 func makeBlockResult(header *types.Header, transactions interface{}) *GetBlockResult {
 	size := uint64(0)
 	uncles := make([]hexutil.Bytes, 0)
@@ -363,6 +440,35 @@ func makeBlockResult(header *types.Header, transactions interface{}) *GetBlockRe
 	}
 }
 
+func makeReceiptResult(tx *evm.ProcessedTx, blockHash arbcommon.Hash) *GetTransactionReceiptResult {
+	res := tx.Result
+	receipt := res.ToEthReceipt(blockHash)
+
+	var contractAddress *common.Address
+	emptyAddress := common.Address{}
+	if receipt.ContractAddress != emptyAddress {
+		contractAddress = &receipt.ContractAddress
+	}
+
+	return &GetTransactionReceiptResult{
+		TransactionHash:   receipt.TxHash,
+		TransactionIndex:  hexutil.Uint64(receipt.TransactionIndex),
+		BlockHash:         receipt.BlockHash,
+		BlockNumber:       (*hexutil.Big)(receipt.BlockNumber),
+		From:              res.IncomingRequest.Sender.ToEthAddress(),
+		To:                tx.Tx.To(),
+		CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+		GasUsed:           hexutil.Uint64(receipt.GasUsed),
+		ContractAddress:   contractAddress,
+		Logs:              receipt.Logs,
+		LogsBloom:         receipt.Bloom.Bytes(),
+		Status:            hexutil.Uint64(receipt.Status),
+
+		ReturnCode: hexutil.Uint64(res.ResultCode),
+		ReturnData: res.ReturnData,
+	}
+}
+
 func makeTransactionResult(processedTx *evm.ProcessedTx, blockHash *common.Hash) *TransactionResult {
 	tx := processedTx.Tx
 	res := processedTx.Result
@@ -454,6 +560,83 @@ func (s *Server) executeCall(args CallTxArgs, blockNum *rpc.BlockNumber) (*evm.T
 	return snap.Call(msg, from)
 }
 
+func (s *Server) blockInfoByNumberOrHash(blockNrOrHash *rpc.BlockNumberOrHash) (*machine.BlockInfo, error) {
+	if blockNum, ok := blockNrOrHash.Number(); ok {
+		height, err := s.blockNum(&blockNum)
+		if err != nil {
+			return nil, err
+		}
+		return s.srv.BlockInfoByNumber(height)
+	}
+	blockHash, _ := blockNrOrHash.Hash()
+	return s.srv.BlockInfoByHash(arbcommon.NewHashFromEth(blockHash))
+}
+
+func (s *Server) getSnapshotByNumberOrHash(blockNrOrHash *rpc.BlockNumberOrHash) (*snapshot.Snapshot, error) {
+	if blockNrOrHash == nil {
+		return s.getSnapshot(nil)
+	}
+	if blockNum, ok := blockNrOrHash.Number(); ok {
+		return s.getSnapshot(&blockNum)
+	}
+	blockHash, _ := blockNrOrHash.Hash()
+	info, err := s.srv.BlockInfoByHash(arbcommon.NewHashFromEth(blockHash))
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, errors.New("block not found")
+	}
+	snap, err := s.srv.GetSnapshot(info.Header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return nil, errors.New("unsupported block hash")
+	}
+	return snap, nil
+}
+
+func applyOverrides(snap *snapshot.Snapshot, overrides map[common.Address]AccountOverrideArgs) (*snapshot.Snapshot, error) {
+	snap = snap.Clone()
+	for account, args := range overrides {
+		err := snap.ApplyOverride(arbcommon.NewAddressFromEth(account), args.accountOverride())
+		if err != nil {
+			return nil, errors2.Wrapf(err, "error overriding state of %v", account.Hex())
+		}
+	}
+	return snap, nil
+}
+
+func (args AccountOverrideArgs) accountOverride() snapshot.AccountOverride {
+	var override snapshot.AccountOverride
+	if args.Nonce != nil {
+		nonce := uint64(*args.Nonce)
+		override.Nonce = &nonce
+	}
+	if args.Code != nil {
+		override.Code = *args.Code
+	}
+	if args.Balance != nil {
+		override.Balance = args.Balance.ToInt()
+	}
+	if args.State != nil {
+		override.State = convertStorage(*args.State)
+	}
+	if args.StateDiff != nil {
+		override.StateDiff = convertStorage(*args.StateDiff)
+	}
+	return override
+}
+
+func convertStorage(storage map[common.Hash]common.Hash) map[arbcommon.Hash]arbcommon.Hash {
+	converted := make(map[arbcommon.Hash]arbcommon.Hash, len(storage))
+	for key, val := range storage {
+		converted[arbcommon.NewHashFromEth(key)] = arbcommon.NewHashFromEth(val)
+	}
+	return converted
+}
+
 func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, error) {
 	if blockNum == nil || *blockNum == rpc.PendingBlockNumber {
 		return s.srv.PendingSnapshot(), nil
@@ -463,7 +646,11 @@ func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, err
 		return s.srv.LatestSnapshot(), nil
 	}
 
-	snap, err := s.srv.GetSnapshot(uint64(*blockNum))
+	height, err := s.blockNum(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := s.srv.GetSnapshot(height)
 	if err != nil {
 		return nil, err
 	}
@@ -477,6 +664,8 @@ func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, err
 func (s *Server) blockNum(block *rpc.BlockNumber) (uint64, error) {
 	if *block == rpc.LatestBlockNumber {
 		return s.srv.GetBlockCount(), nil
+	} else if *block == aggregator.SafeBlockNumber || *block == aggregator.FinalizedBlockNumber {
+		return s.srv.FinalityBlockNum(*block)
 	} else if *block >= 0 {
 		return uint64(*block), nil
 	} else {
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func newPendingTxResult(t *testing.T, gasUsed int64) *evm.TxResult {
+	l2, err := message.NewL2Message(message.Transaction{
+		MaxGas:      big.NewInt(1000000),
+		GasPriceBid: big.NewInt(0),
+		SequenceNum: big.NewInt(0),
+		DestAddress: common.RandAddress(),
+		Payment:     big.NewInt(0),
+		Data:        []byte{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := evm.NewRandomResult(2)
+	res.IncomingRequest.Kind = message.L2Type
+	res.IncomingRequest.Data = l2.Data
+	res.GasUsed = big.NewInt(gasUsed)
+	return res
+}
+
+func TestPendingBlock(t *testing.T) {
+	latest := &types.Header{
+		Number:     big.NewInt(10),
+		Difficulty: big.NewInt(1),
+		GasLimit:   1000000,
+		Time:       100,
+	}
+	deposit := evm.NewRandomResult(0)
+	deposit.IncomingRequest.Kind = message.EthType
+	results := []*evm.TxResult{
+		newPendingTxResult(t, 100),
+		deposit,
+		newPendingTxResult(t, 50),
+	}
+	now := time.Now()
+
+	block := makePendingBlock(latest, results, false, now)
+	if block.Hash != nil {
+		t.Error("pending block has a hash")
+	}
+	if block.Nonce != nil {
+		t.Error("pending block has a nonce")
+	}
+	if block.Number.ToInt().Cmp(big.NewInt(11)) != 0 {
+		t.Error("unexpected block number", block.Number)
+	}
+	if !bytes.Equal(block.ParentHash, latest.Hash().Bytes()) {
+		t.Error("pending block isn't built on the latest block")
+	}
+	if uint64(*block.Timestamp) != uint64(now.Unix()) {
+		t.Error("unexpected timestamp", *block.Timestamp)
+	}
+	if uint64(*block.GasUsed) != 150 {
+		t.Error("unexpected gas used", *block.GasUsed)
+	}
+	txHashes, ok := block.Transactions.([]hexutil.Bytes)
+	if !ok {
+		t.Fatal("unexpected transactions type")
+	}
+	if len(txHashes) != 2 {
+		t.Fatal("unexpected transaction count", len(txHashes))
+	}
+	for i, res := range []*evm.TxResult{results[0], results[2]} {
+		if !bytes.Equal(txHashes[i], res.IncomingRequest.MessageID.Bytes()) {
+			t.Error("unexpected transaction hash at index", i)
+		}
+	}
+	bloom := types.BytesToBloom(block.LogsBloom)
+	for _, ethLog := range results[0].EthLogs(common.Hash{}) {
+		if !bloom.Test(ethLog.Address.Bytes()) {
+			t.Error("bloom is missing log address")
+		}
+	}
+
+	block = makePendingBlock(latest, results, true, now)
+	txResults, ok := block.Transactions.([]*TransactionResult)
+	if !ok {
+		t.Fatal("unexpected transactions type")
+	}
+	for _, txRes := range txResults {
+		if txRes.BlockHash != nil {
+			t.Error("pending transaction has a block hash")
+		}
+		if txRes.BlockNumber.ToInt().Cmp(big.NewInt(11)) != 0 {
+			t.Error("pending transaction has block number", txRes.BlockNumber)
+		}
+	}
+}
@@ -38,6 +38,129 @@ type CallTxArgs struct {
 	Data     *hexutil.Bytes  `json:"data"`
 }
 
+// AccountOverrideArgs specifies the state of an account to use when
+// executing a call in the same format as geth's eth_call state override set.
+type AccountOverrideArgs struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// TransactionStatusResult is the stage of a transaction between submission
+// and confirmation
+type TransactionStatusResult struct {
+	Status      string       `json:"status"`
+	BatchTxHash *common.Hash `json:"batchTxHash"`
+	BlockNumber *hexutil.Big `json:"blockNumber"`
+	Confirmed   bool         `json:"confirmed"`
+}
+
+// InboxBatchResult is an inbox message along with the L1 transaction which
+// delivered it and the L2 transactions it contained
+type InboxBatchResult struct {
+	InboxSeqNum   *hexutil.Big   `json:"inboxSeqNum"`
+	Kind          hexutil.Uint64 `json:"kind"`
+	Sender        common.Address `json:"sender"`
+	L1TxHash      common.Hash    `json:"l1TxHash"`
+	L1BlockHash   common.Hash    `json:"l1BlockHash"`
+	L1BlockNumber *hexutil.Big   `json:"l1BlockNumber"`
+	L1LogIndex    hexutil.Uint64 `json:"l1LogIndex"`
+	Transactions  []common.Hash  `json:"transactions"`
+}
+
+// L1OriginResult locates the inbox message and L1 transaction an L2
+// transaction came from. The L1 fields are null if the inbox message
+// predates the batch index
+type L1OriginResult struct {
+	InboxSeqNum     *hexutil.Big `json:"inboxSeqNum"`
+	L1TxHash        *common.Hash `json:"l1TxHash"`
+	L1BlockHash     *common.Hash `json:"l1BlockHash"`
+	L1BlockNumber   *hexutil.Big `json:"l1BlockNumber"`
+	ParentRequestId *common.Hash `json:"parentRequestId"`
+	IndexInParent   *hexutil.Big `json:"indexInParent"`
+}
+
+// DepositStatusArgs selects deposits by the L1 transaction which made them,
+// by inbox sequence number or by both
+type DepositStatusArgs struct {
+	L1TxHash    *common.Hash `json:"l1TxHash"`
+	InboxSeqNum *hexutil.Big `json:"inboxSeqNum"`
+}
+
+// DepositResult is an L1 deposit and its L2 outcome. Status is pending until
+// the deposit has been executed and then credited or failed
+type DepositResult struct {
+	Status        string          `json:"status"`
+	Kind          string          `json:"kind"`
+	InboxSeqNum   *hexutil.Big    `json:"inboxSeqNum"`
+	Sender        common.Address  `json:"sender"`
+	Dest          *common.Address `json:"dest"`
+	Token         *common.Address `json:"token"`
+	Value         *hexutil.Big    `json:"value"`
+	L1TxHash      *common.Hash    `json:"l1TxHash"`
+	L1BlockNumber *hexutil.Big    `json:"l1BlockNumber"`
+	RequestId     *common.Hash    `json:"requestId"`
+	ResultCode    *hexutil.Uint64 `json:"resultCode"`
+}
+
+// WithdrawalsArgs selects withdrawals by the L2 transaction which made them
+// or by their L1 recipient
+type WithdrawalsArgs struct {
+	TxHash *common.Hash    `json:"txHash"`
+	Dest   *common.Address `json:"dest"`
+}
+
+// AssertionResult is the rollup assertion which sent a withdrawal to L1
+type AssertionResult struct {
+	L1BlockNumber  *hexutil.Big   `json:"l1BlockNumber"`
+	L1BlockHash    common.Hash    `json:"l1BlockHash"`
+	BeforeLogCount hexutil.Uint64 `json:"beforeLogCount"`
+	AfterLogCount  hexutil.Uint64 `json:"afterLogCount"`
+}
+
+// WithdrawalResult is a withdrawal to L1. Status is pending until the
+// withdrawal is asserted and then asserted until the assertion is confirmed,
+// at which point the withdrawal can be claimed
+type WithdrawalResult struct {
+	Status      string           `json:"status"`
+	Claimable   bool             `json:"claimable"`
+	Kind        string           `json:"kind"`
+	Sender      common.Address   `json:"sender"`
+	Dest        common.Address   `json:"dest"`
+	Token       *common.Address  `json:"token"`
+	Value       *hexutil.Big     `json:"value"`
+	TxHash      common.Hash      `json:"txHash"`
+	BlockNumber *hexutil.Big     `json:"blockNumber"`
+	SendIndex   hexutil.Uint64   `json:"sendIndex"`
+	Assertion   *AssertionResult `json:"assertion"`
+}
+
+// TransactionsByAddressArgs selects a page of an account's transaction
+// history. Before is the cursor returned with the previous page
+type TransactionsByAddressArgs struct {
+	Address common.Address  `json:"address"`
+	Before  *hexutil.Uint64 `json:"before"`
+	Limit   *hexutil.Uint64 `json:"limit"`
+}
+
+// AddressTransactionResult is an entry in an account's transaction history
+type AddressTransactionResult struct {
+	Hash             common.Hash    `json:"hash"`
+	BlockNumber      *hexutil.Big   `json:"blockNumber"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	From             common.Address `json:"from"`
+	ReturnCode       hexutil.Uint64 `json:"returnCode"`
+}
+
+// TransactionsByAddressResult is a page of an account's transaction history,
+// most recent first. Next is nil on the last page
+type TransactionsByAddressResult struct {
+	Transactions []*AddressTransactionResult `json:"transactions"`
+	Next         *hexutil.Uint64             `json:"next"`
+}
+
 // Receipt represents the results of a transaction.
 type GetTransactionReceiptResult struct {
 	TransactionHash   common.Hash     `json:"transactionHash"`
@@ -81,3 +204,77 @@ type TransactionResult struct {
 	ArbType         hexutil.Uint64  `json:"arbType"`
 	ArbSubType      *hexutil.Uint64 `json:"arbSubType"`
 }
+
+// CallFrame describes the execution of the top level call of a transaction.
+// ArbOS doesn't report internal calls, so there are no nested frames and
+// Logs holds every log emitted during the transaction
+type CallFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Logs         []*types.Log    `json:"logs"`
+}
+
+// TraceConfig holds the options of debug_traceTransaction and
+// debug_traceCall. Only the callTracer output format is supported, which is
+// also used if no tracer is given. Other geth tracing options are ignored
+type TraceConfig struct {
+	Tracer *string `json:"tracer"`
+}
+
+// TransactionTrace follows the output of geth's callTracer, but calls is
+// always omitted since internal calls can't be traced. topLevelOnly is
+// always true to make this explicit to clients
+type TransactionTrace struct {
+	*CallFrame
+
+	// Arbitrum Specific Fields
+	TopLevelOnly bool           `json:"topLevelOnly"`
+	ReturnCode   hexutil.Uint64 `json:"returnCode"`
+	GasPrice     *hexutil.Big   `json:"gasPrice"`
+}
+
+type TxPoolContent struct {
+	Pending map[common.Address]map[string]*TransactionResult `json:"pending"`
+	Queued  map[common.Address]map[string]*TransactionResult `json:"queued"`
+
+	// Arbitrum Specific Fields
+	Sent     map[common.Hash]map[common.Address]map[string]*TransactionResult `json:"sent"`
+	Retrying map[common.Address]map[string]*TransactionResult                 `json:"retrying"`
+}
+
+type TxPoolInspect struct {
+	Pending map[common.Address]map[string]string `json:"pending"`
+	Queued  map[common.Address]map[string]string `json:"queued"`
+
+	// Arbitrum Specific Fields
+	Sent     map[common.Hash]map[common.Address]map[string]string `json:"sent"`
+	Retrying map[common.Address]map[string]string                 `json:"retrying"`
+}
+
+type TxPoolStatus struct {
+	Pending hexutil.Uint `json:"pending"`
+	Queued  hexutil.Uint `json:"queued"`
+
+	// Arbitrum Specific Fields
+	Sent            hexutil.Uint `json:"sent"`
+	SentBatches     hexutil.Uint `json:"sentBatches"`
+	Retrying        hexutil.Uint `json:"retrying"`
+	RetryingBatches hexutil.Uint `json:"retryingBatches"`
+}
+
+type BatchResult struct {
+	TxHash           *common.Hash   `json:"txHash"`
+	PreviousTxHashes []common.Hash  `json:"previousTxHashes"`
+	Status           string         `json:"status"`
+	Attempts         hexutil.Uint64 `json:"attempts"`
+	GasPrice         *hexutil.Big   `json:"gasPrice"`
+	Transactions     []common.Hash  `json:"transactions"`
+}
@@ -27,7 +27,8 @@ import (
 func GenerateWeb3Server(server *aggregator.Server) (*rpc.Server, error) {
 	s := rpc.NewServer()
 
-	if err := s.RegisterName("eth", NewServer(server)); err != nil {
+	ethServer := NewServer(server)
+	if err := s.RegisterName("eth", ethServer); err != nil {
 		return nil, err
 	}
 
@@ -44,5 +45,17 @@ func GenerateWeb3Server(server *aggregator.Server) (*rpc.Server, error) {
 		return nil, err
 	}
 
+	if err := s.RegisterName("debug", NewDebug(ethServer)); err != nil {
+		return nil, err
+	}
+
+	if err := s.RegisterName("txpool", NewTxPool(server)); err != nil {
+		return nil, err
+	}
+
+	if err := s.RegisterName("arb", NewArb(server)); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+var errNoPoolContent = errors.New("transaction pool not available for this aggregator")
+
+// TxPool implements the txpool namespace. Queued transactions are waiting to
+// be added to a batch, pending transactions are in the batch currently being
+// assembled, sent transactions are in batches that have been submitted to L1
+// but haven't been confirmed yet and retrying transactions are in batches
+// whose latest submission failed and will be sent again.
+type TxPool struct {
+	srv    poolContentSource
+	signer types.Signer
+}
+
+// poolContentSource provides the transactions held by the batcher
+type poolContentSource interface {
+	PoolContent() *batcher.PoolContent
+}
+
+func NewTxPool(srv *aggregator.Server) *TxPool {
+	chainId := message.ChainAddressToID(arbcommon.NewAddressFromEth(srv.GetChainAddress()))
+	return &TxPool{
+		srv:    srv,
+		signer: types.NewEIP155Signer(chainId),
+	}
+}
+
+// Content returns the transactions contained within the transaction pool
+func (t *TxPool) Content() (*TxPoolContent, error) {
+	pool := t.srv.PoolContent()
+	if pool == nil {
+		return nil, errNoPoolContent
+	}
+	content := &TxPoolContent{
+		Pending:  make(map[common.Address]map[string]*TransactionResult),
+		Queued:   make(map[common.Address]map[string]*TransactionResult),
+		Sent:     make(map[common.Hash]map[common.Address]map[string]*TransactionResult),
+		Retrying: make(map[common.Address]map[string]*TransactionResult),
+	}
+	t.addContent(content.Pending, pool.Pending)
+	for _, txes := range pool.Queued {
+		t.addContent(content.Queued, txes)
+	}
+	for _, batch := range pool.Sent {
+		if batch.Status == batcher.BatchRetrying {
+			t.addContent(content.Retrying, batch.Txes)
+			continue
+		}
+		sent := make(map[common.Address]map[string]*TransactionResult)
+		t.addContent(sent, batch.Txes)
+		content.Sent[batch.TxHash.ToEthHash()] = sent
+	}
+	return content, nil
+}
+
+// Inspect returns a textual summary of the transactions contained within the
+// transaction pool
+func (t *TxPool) Inspect() (*TxPoolInspect, error) {
+	pool := t.srv.PoolContent()
+	if pool == nil {
+		return nil, errNoPoolContent
+	}
+	inspect := &TxPoolInspect{
+		Pending:  make(map[common.Address]map[string]string),
+		Queued:   make(map[common.Address]map[string]string),
+		Sent:     make(map[common.Hash]map[common.Address]map[string]string),
+		Retrying: make(map[common.Address]map[string]string),
+	}
+	t.addInspect(inspect.Pending, pool.Pending)
+	for _, txes := range pool.Queued {
+		t.addInspect(inspect.Queued, txes)
+	}
+	for _, batch := range pool.Sent {
+		if batch.Status == batcher.BatchRetrying {
+			t.addInspect(inspect.Retrying, batch.Txes)
+			continue
+		}
+		sent := make(map[common.Address]map[string]string)
+		t.addInspect(sent, batch.Txes)
+		inspect.Sent[batch.TxHash.ToEthHash()] = sent
+	}
+	return inspect, nil
+}
+
+// Status returns the number of transactions in each stage of the transaction
+// pool
+func (t *TxPool) Status() (*TxPoolStatus, error) {
+	pool := t.srv.PoolContent()
+	if pool == nil {
+		return nil, errNoPoolContent
+	}
+	queued := 0
+	for _, txes := range pool.Queued {
+		queued += len(txes)
+	}
+	status := &TxPoolStatus{
+		Pending: hexutil.Uint(len(pool.Pending)),
+		Queued:  hexutil.Uint(queued),
+	}
+	for _, batch := range pool.Sent {
+		if batch.Status == batcher.BatchRetrying {
+			status.Retrying += hexutil.Uint(len(batch.Txes))
+			status.RetryingBatches++
+		} else {
+			status.Sent += hexutil.Uint(len(batch.Txes))
+			status.SentBatches++
+		}
+	}
+	return status, nil
+}
+
+// Batches returns the status of the batches that are waiting to be included
+// on L1 followed by the most recently completed batches
+func (t *TxPool) Batches() ([]*BatchResult, error) {
+	pool := t.srv.PoolContent()
+	if pool == nil {
+		return nil, errNoPoolContent
+	}
+	results := make([]*BatchResult, 0, len(pool.Sent)+len(pool.Completed))
+	for _, batch := range pool.Sent {
+		results = append(results, makeBatchResult(batch))
+	}
+	for _, batch := range pool.Completed {
+		results = append(results, makeBatchResult(batch))
+	}
+	return results, nil
+}
+
+func makeBatchResult(batch batcher.SentBatch) *BatchResult {
+	var txHash *common.Hash
+	if batch.TxHash != (arbcommon.Hash{}) {
+		h := batch.TxHash.ToEthHash()
+		txHash = &h
+	}
+	previousTxHashes := make([]common.Hash, 0, len(batch.PreviousTxHashes))
+	for _, h := range batch.PreviousTxHashes {
+		previousTxHashes = append(previousTxHashes, h.ToEthHash())
+	}
+	transactions := make([]common.Hash, 0, len(batch.Txes))
+	for _, tx := range batch.Txes {
+		transactions = append(transactions, tx.Hash())
+	}
+	return &BatchResult{
+		TxHash:           txHash,
+		PreviousTxHashes: previousTxHashes,
+		Status:           batch.Status.String(),
+		Attempts:         hexutil.Uint64(batch.Attempts),
+		GasPrice:         (*hexutil.Big)(batch.GasPrice),
+		Transactions:     transactions,
+	}
+}
+
+func (t *TxPool) addContent(content map[common.Address]map[string]*TransactionResult, txes []*types.Transaction) {
+	for _, tx := range txes {
+		sender, err := types.Sender(t.signer, tx)
+		if err != nil {
+			continue
+		}
+		if _, ok := content[sender]; !ok {
+			content[sender] = make(map[string]*TransactionResult)
+		}
+		content[sender][fmt.Sprint(tx.Nonce())] = makePoolTransactionResult(tx, sender)
+	}
+}
+
+func (t *TxPool) addInspect(inspect map[common.Address]map[string]string, txes []*types.Transaction) {
+	for _, tx := range txes {
+		sender, err := types.Sender(t.signer, tx)
+		if err != nil {
+			continue
+		}
+		if _, ok := inspect[sender]; !ok {
+			inspect[sender] = make(map[string]string)
+		}
+		inspect[sender][fmt.Sprint(tx.Nonce())] = inspectTransaction(tx)
+	}
+}
+
+func inspectTransaction(tx *types.Transaction) string {
+	if to := tx.To(); to != nil {
+		return fmt.Sprintf("%s: %v wei + %v gas × %v wei", to.Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
+	}
+	return fmt.Sprintf("contract creation: %v wei + %v gas × %v wei", tx.Value(), tx.Gas(), tx.GasPrice())
+}
+
+// makePoolTransactionResult formats a transaction that hasn't been included
+// in a block yet
+func makePoolTransactionResult(tx *types.Transaction, sender common.Address) *TransactionResult {
+	vVal, rVal, sVal := tx.RawSignatureValues()
+	l2Subtype := hexutil.Uint64(message.SignedTransactionType)
+	return &TransactionResult{
+		From:       sender,
+		Gas:        hexutil.Uint64(tx.Gas()),
+		GasPrice:   (*hexutil.Big)(tx.GasPrice()),
+		Hash:       tx.Hash(),
+		Input:      tx.Data(),
+		Nonce:      hexutil.Uint64(tx.Nonce()),
+		To:         tx.To(),
+		Value:      (*hexutil.Big)(tx.Value()),
+		V:          (*hexutil.Big)(vVal),
+		R:          (*hexutil.Big)(rVal),
+		S:          (*hexutil.Big)(sVal),
+		ArbType:    hexutil.Uint64(message.L2Type),
+		ArbSubType: &l2Subtype,
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+type testPoolSource struct {
+	content *batcher.PoolContent
+}
+
+func (s testPoolSource) PoolContent() *batcher.PoolContent {
+	return s.content
+}
+
+func TestTxPool(t *testing.T) {
+	signer := types.NewEIP155Signer(message.ChainAddressToID(arbcommon.RandAddress()))
+	keys := make([]*ecdsa.PrivateKey, 0, 2)
+	senders := make([]common.Address, 0, 2)
+	for i := 0; i < 2; i++ {
+		pk, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pk)
+		senders = append(senders, crypto.PubkeyToAddress(pk.PublicKey))
+	}
+	makeTx := func(pk *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+		tx := types.NewTransaction(nonce, common.Address{6}, big.NewInt(0), 1000, big.NewInt(10), nil)
+		signedTx, err := types.SignTx(tx, signer, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signedTx
+	}
+
+	// senders[0] has nonces 0 and 1 in a sent batch, 2 in a retrying batch
+	// and 3 and 4 queued while senders[1] has nonces 0 and 1 pending
+	sentTxes := []*types.Transaction{makeTx(keys[0], 0), makeTx(keys[0], 1)}
+	retryingTx := makeTx(keys[0], 2)
+	queuedTxes := []*types.Transaction{makeTx(keys[0], 3), makeTx(keys[0], 4)}
+	pendingTxes := []*types.Transaction{makeTx(keys[1], 0), makeTx(keys[1], 1)}
+	completedTx := makeTx(keys[1], 5)
+	sentHash := arbcommon.RandHash()
+	pool := &TxPool{
+		srv: testPoolSource{content: &batcher.PoolContent{
+			Queued:  map[common.Address][]*types.Transaction{senders[0]: queuedTxes},
+			Pending: pendingTxes,
+			Sent: []batcher.SentBatch{
+				{TxHash: sentHash, Txes: sentTxes, Status: batcher.BatchSubmitted, Attempts: 1},
+				{Txes: []*types.Transaction{retryingTx}, Status: batcher.BatchRetrying, Attempts: 1},
+			},
+			Completed: []batcher.SentBatch{
+				{TxHash: arbcommon.RandHash(), Txes: []*types.Transaction{completedTx}, Status: batcher.BatchConfirmed},
+			},
+		}},
+		signer: signer,
+	}
+
+	type expectedTx struct {
+		sender common.Address
+		tx     *types.Transaction
+	}
+	expectedPending := []expectedTx{{senders[1], pendingTxes[0]}, {senders[1], pendingTxes[1]}}
+	expectedQueued := []expectedTx{{senders[0], queuedTxes[0]}, {senders[0], queuedTxes[1]}}
+	expectedSent := []expectedTx{{senders[0], sentTxes[0]}, {senders[0], sentTxes[1]}}
+	expectedRetrying := []expectedTx{{senders[0], retryingTx}}
+
+	t.Run("Content", func(t *testing.T) {
+		content, err := pool.Content()
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(name string, txes map[common.Address]map[string]*TransactionResult, expected []expectedTx) {
+			t.Helper()
+			count := 0
+			for _, byNonce := range txes {
+				count += len(byNonce)
+			}
+			if count != len(expected) {
+				t.Error(name, "has", count, "txes instead of", len(expected))
+			}
+			for _, e := range expected {
+				res := txes[e.sender][fmt.Sprint(e.tx.Nonce())]
+				if res == nil {
+					t.Error(name, "is missing tx with nonce", e.tx.Nonce())
+					continue
+				}
+				if res.Hash != e.tx.Hash() || res.From != e.sender {
+					t.Error(name, "has wrong tx with nonce", e.tx.Nonce())
+				}
+			}
+		}
+		check("pending", content.Pending, expectedPending)
+		check("queued", content.Queued, expectedQueued)
+		check("retrying", content.Retrying, expectedRetrying)
+		if len(content.Sent) != 1 {
+			t.Fatal("unexpected sent batch count", len(content.Sent))
+		}
+		check("sent", content.Sent[sentHash.ToEthHash()], expectedSent)
+	})
+
+	t.Run("Inspect", func(t *testing.T) {
+		inspect, err := pool.Inspect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(name string, txes map[common.Address]map[string]string, expected []expectedTx) {
+			t.Helper()
+			count := 0
+			for _, byNonce := range txes {
+				count += len(byNonce)
+			}
+			if count != len(expected) {
+				t.Error(name, "has", count, "txes instead of", len(expected))
+			}
+			for _, e := range expected {
+				summary := txes[e.sender][fmt.Sprint(e.tx.Nonce())]
+				if summary != "0x0600000000000000000000000000000000000000: 0 wei + 1000 gas × 10 wei" {
+					t.Error(name, "has unexpected summary", summary, "for nonce", e.tx.Nonce())
+				}
+			}
+		}
+		check("pending", inspect.Pending, expectedPending)
+		check("queued", inspect.Queued, expectedQueued)
+		check("retrying", inspect.Retrying, expectedRetrying)
+		if len(inspect.Sent) != 1 {
+			t.Fatal("unexpected sent batch count", len(inspect.Sent))
+		}
+		check("sent", inspect.Sent[sentHash.ToEthHash()], expectedSent)
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		status, err := pool.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := TxPoolStatus{
+			Pending:         2,
+			Queued:          2,
+			Sent:            2,
+			SentBatches:     1,
+			Retrying:        1,
+			RetryingBatches: 1,
+		}
+		if *status != expected {
+			t.Errorf("unexpected status %+v", *status)
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		pool := &TxPool{srv: testPoolSource{}, signer: signer}
+		if _, err := pool.Content(); err != errNoPoolContent {
+			t.Error("unexpected content error", err)
+		}
+		if _, err := pool.Inspect(); err != errNoPoolContent {
+			t.Error("unexpected inspect error", err)
+		}
+		if _, err := pool.Status(); err != errNoPoolContent {
+			t.Error("unexpected status error", err)
+		}
+	})
+}
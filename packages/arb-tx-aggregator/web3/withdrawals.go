@@ -0,0 +1,81 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// GetWithdrawals returns the withdrawals made by an L2 transaction or to an
+// L1 recipient along with whether they can be claimed yet
+func (a *Arb) GetWithdrawals(ctx context.Context, args WithdrawalsArgs) ([]*WithdrawalResult, error) {
+	var txHash *arbcommon.Hash
+	var dest *arbcommon.Address
+	if args.TxHash == nil && args.Dest == nil {
+		return nil, errors.New("txHash or dest is required")
+	}
+	if args.TxHash != nil {
+		hash := arbcommon.NewHashFromEth(*args.TxHash)
+		txHash = &hash
+	}
+	if args.Dest != nil {
+		address := arbcommon.NewAddressFromEth(*args.Dest)
+		dest = &address
+	}
+	statuses, err := a.srv.GetWithdrawals(txHash, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*WithdrawalResult, 0, len(statuses))
+	for _, status := range statuses {
+		withdrawal := status.Withdrawal
+		msg, err := withdrawal.Message()
+		if err != nil {
+			return nil, err
+		}
+		result := &WithdrawalResult{
+			Status:      "pending",
+			Kind:        transferKindName(withdrawal.Kind),
+			Sender:      withdrawal.Sender.ToEthAddress(),
+			TxHash:      withdrawal.TxHash.ToEthHash(),
+			BlockNumber: (*hexutil.Big)(withdrawal.BlockNum),
+			SendIndex:   hexutil.Uint64(withdrawal.SendIndex),
+		}
+		result.Dest, result.Token, result.Value = transferDetails(msg)
+		if status.Assertion != nil {
+			result.Status = "asserted"
+			result.Assertion = &AssertionResult{
+				L1BlockNumber:  (*hexutil.Big)(status.Assertion.L1BlockNum),
+				L1BlockHash:    status.Assertion.L1BlockHash.ToEthHash(),
+				BeforeLogCount: hexutil.Uint64(status.Assertion.BeforeLogCount),
+				AfterLogCount:  hexutil.Uint64(status.Assertion.AfterLogCount),
+			}
+		}
+		if status.Confirmed {
+			result.Status = "confirmed"
+			result.Claimable = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
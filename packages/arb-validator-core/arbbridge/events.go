@@ -132,6 +132,7 @@ type AssertedEvent struct {
 	MessageCount     uint64
 	LastLogHash      common.Hash
 	LogCount         uint64
+	BeforeLogCount   *big.Int
 }
 
 type ConfirmedEvent struct {
@@ -190,6 +191,8 @@ type ExecutionBisectionEvent struct {
 
 type MessageDeliveredEvent struct {
 	ChainInfo
+	// TxHash is the L1 transaction which delivered the message
+	TxHash  common.Hash
 	Message inbox.InboxMessage
 }
 
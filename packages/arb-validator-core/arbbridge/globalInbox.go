@@ -66,6 +66,19 @@ type GlobalInboxSender interface {
 		data []byte,
 	) (common.Hash, error)
 
+	// SendL2MessageNoWaitWithGasPrice behaves like SendL2MessageNoWait but
+	// bids the given L1 gas price, or the suggested gas price if gasPrice is
+	// nil. If nonce isn't nil the transaction is sent with that nonce, which
+	// replaces an earlier submission with the same nonce. It returns the hash
+	// of the submitted transaction along with the gas price and nonce that
+	// were used
+	SendL2MessageNoWaitWithGasPrice(
+		ctx context.Context,
+		data []byte,
+		gasPrice *big.Int,
+		nonce *big.Int,
+	) (common.Hash, *big.Int, *big.Int, error)
+
 	DepositEthMessage(
 		ctx context.Context,
 		destination common.Address,
@@ -260,6 +260,7 @@ func (vm *ethRollupWatcher) processEvents(
 			MessageCount:     eventVal.MessageCount,
 			LastLogHash:      eventVal.Fields[5],
 			LogCount:         eventVal.LogCount,
+			BeforeLogCount:   eventVal.BeforeLogCount,
 		}, nil
 	case rollupConfirmedID:
 		eventVal, err := vm.ArbRollup.ParseRollupConfirmed(ethLog)
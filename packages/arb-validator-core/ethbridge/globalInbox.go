@@ -87,6 +87,32 @@ func (con *globalInbox) SendL2MessageNoWait(ctx context.Context, data []byte) (c
 	return common.NewHashFromEth(tx.Hash()), nil
 }
 
+func (con *globalInbox) SendL2MessageNoWaitWithGasPrice(ctx context.Context, data []byte, gasPrice *big.Int, nonce *big.Int) (common.Hash, *big.Int, *big.Int, error) {
+	con.auth.Lock()
+	defer con.auth.Unlock()
+	if gasPrice == nil {
+		var err error
+		gasPrice, err = con.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return common.Hash{}, nil, nil, err
+		}
+	}
+	auth := con.auth.getAuth(ctx)
+	auth.GasPrice = gasPrice
+	if nonce != nil {
+		auth.Nonce = nonce
+	}
+	tx, err := con.GlobalInbox.SendL2MessageFromOrigin(
+		auth,
+		con.rollupAddress,
+		data,
+	)
+	if err != nil {
+		return common.Hash{}, nil, nil, err
+	}
+	return common.NewHashFromEth(tx.Hash()), gasPrice, new(big.Int).SetUint64(tx.Nonce()), nil
+}
+
 func (con *globalInbox) DepositEthMessage(
 	ctx context.Context,
 	destination common.Address,
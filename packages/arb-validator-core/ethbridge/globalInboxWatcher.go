@@ -181,6 +181,7 @@ func (gi *globalInboxWatcher) parseMessageFromOrigin(evmLog types.Log, timestamp
 	}
 	return arbbridge.MessageDeliveredEvent{
 		ChainInfo: getLogChainInfo(evmLog),
+		TxHash:    common.NewHashFromEth(evmLog.TxHash),
 		Message: inbox.InboxMessage{
 			Kind:        inbox.Type(val.Kind),
 			Sender:      common.NewAddressFromEth(val.Sender),
@@ -211,6 +212,7 @@ func (gi *globalInboxWatcher) processLog(
 		}
 		return arbbridge.MessageDeliveredEvent{
 			ChainInfo: chainInfo,
+			TxHash:    common.NewHashFromEth(evmLog.TxHash),
 			Message: inbox.InboxMessage{
 				Kind:        inbox.Type(val.Kind),
 				Sender:      common.NewAddressFromEth(val.Sender),